@@ -0,0 +1,82 @@
+package regfish
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/libdns/libdns"
+)
+
+// Backup is the backup BackupAll writes, as JSON.
+type Backup struct {
+	Zones []ZoneBackup `json:"zones"`
+}
+
+// ZoneBackup holds the records of a single zone in a Backup. If the
+// records could not be fetched, Error says why and Records is empty.
+type ZoneBackup struct {
+	Zone    string         `json:"zone"`
+	Records []BackupRecord `json:"records"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// BackupRecord is a record in a Backup. Unlike libdns.Record, it has its
+// TTL in seconds.
+type BackupRecord struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// BackupAll fetches the records of each of the zones and writes them to w
+// as one JSON document, a Backup with a separate entry per zone. The
+// regfish API offers no way to list the zones of an account, so they must
+// be given.
+//
+// A zone whose records cannot be fetched does not stop the backup: it is
+// written with its error, and the failed zones are returned as ZoneErrors
+// once the backup is written. An error writing to w is returned as is.
+func (p *Provider) BackupAll(ctx context.Context, w io.Writer, zones []string) error {
+	backup := Backup{Zones: make([]ZoneBackup, 0, len(zones))}
+	errs := make(ZoneErrors)
+
+	for _, zone := range zones {
+		zb := ZoneBackup{Zone: zone, Records: []BackupRecord{}}
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			zb.Error = err.Error()
+			errs[zone] = err
+		}
+		for _, record := range records {
+			zb.Records = append(zb.Records, newBackupRecord(record))
+		}
+		backup.Zones = append(backup.Zones, zb)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(backup); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// newBackupRecord converts a libdns.Record for a Backup.
+func newBackupRecord(record libdns.Record) BackupRecord {
+	return BackupRecord{
+		ID:       record.ID,
+		Name:     record.Name,
+		Type:     record.Type,
+		Value:    record.Value,
+		TTL:      int(record.TTL.Seconds()),
+		Priority: record.Priority,
+	}
+}
@@ -0,0 +1,68 @@
+package regfish_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupAll(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "MX", Data: "mx.example.com.", TTL: 3600, Priority: intPtr(10)},
+		rfns.Record{Name: "www.example.org.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+	)
+
+	var buf bytes.Buffer
+	err := api.provider().BackupAll(context.Background(), &buf, []string{"example.com.", "example.org."})
+	assert.Nil(t, err)
+
+	var backup regfish.Backup
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &backup))
+	assert.Equal(t, regfish.Backup{Zones: []regfish.ZoneBackup{
+		{Zone: "example.com.", Records: []regfish.BackupRecord{
+			{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.1", TTL: 300},
+			{ID: "1002", Name: "", Type: "MX", Value: "mx.example.com.", TTL: 3600, Priority: 10},
+		}},
+		{Zone: "example.org.", Records: []regfish.BackupRecord{
+			{ID: "1003", Name: "www", Type: "AAAA", Value: "2001:db8::1", TTL: 300},
+		}},
+	}}, backup)
+}
+
+func TestBackupAllPartialFailure(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	api.fail = func(r *http.Request) (int, string) {
+		if strings.Contains(r.URL.Path, "example.org") {
+			return http.StatusForbidden, `{"message": "access denied"}`
+		}
+		return 0, ""
+	}
+
+	var buf bytes.Buffer
+	err := api.provider().BackupAll(context.Background(), &buf, []string{"example.org.", "example.com."})
+
+	var zoneErrs regfish.ZoneErrors
+	if assert.True(t, errors.As(err, &zoneErrs)) {
+		assert.Len(t, zoneErrs, 1)
+		assert.Error(t, zoneErrs["example.org."])
+	}
+
+	var backup regfish.Backup
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &backup))
+	if assert.Len(t, backup.Zones, 2) {
+		assert.Contains(t, backup.Zones[0].Error, "access denied")
+		assert.Empty(t, backup.Zones[0].Records)
+		assert.Len(t, backup.Zones[1].Records, 1)
+	}
+}
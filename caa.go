@@ -0,0 +1,143 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// CAA is the parsed value of a CAA record.
+type CAA struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// Critical reports whether the issuer critical flag is set.
+func (c CAA) Critical() bool {
+	return c.Flags&128 != 0
+}
+
+// ParseCAA parses the value of a CAA record, such as
+// `0 issue "letsencrypt.org"`.
+func ParseCAA(value string) (CAA, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), " ", 3)
+	if len(parts) != 3 {
+		return CAA{}, fmt.Errorf("malformed CAA value %q; expected: '<flags> <tag> <value>'", value)
+	}
+
+	flags, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return CAA{}, fmt.Errorf("invalid CAA flags %s: %v", parts[0], err)
+	}
+
+	tag := parts[1]
+	if tag == "" {
+		return CAA{}, fmt.Errorf("malformed CAA value %q: empty tag", value)
+	}
+
+	v := strings.TrimSpace(parts[2])
+	if unquoted, err := strconv.Unquote(v); err == nil {
+		v = unquoted
+	}
+
+	return CAA{Flags: uint8(flags), Tag: tag, Value: v}, nil
+}
+
+// CAAProblem describes a problem found in the CAA records of a zone.
+type CAAProblem struct {
+	Record  libdns.Record
+	Problem string
+}
+
+// knownCAATags are the CAA property tags certificate authorities know.
+var knownCAATags = map[string]bool{
+	"issue":        true,
+	"issuewild":    true,
+	"issuemail":    true,
+	"issuevmc":     true,
+	"iodef":        true,
+	"contactemail": true,
+	"contactphone": true,
+}
+
+// CheckCAA checks the CAA records among records for mistakes that can
+// block certificate issuance or make the policy ambiguous: malformed
+// values, reserved flag bits, the critical flag on a tag certificate
+// authorities do not know (which makes them refuse to issue at all), and
+// issue or issuewild properties that forbid issuance (";") next to ones
+// that allow it at the same name. Records of other types are ignored.
+func CheckCAA(records []libdns.Record) []CAAProblem {
+	var problems []CAAProblem
+
+	type policy struct{ deny, allow []libdns.Record }
+	policies := make(map[string]*policy)
+	var keys []string
+
+	for _, rec := range records {
+		if !strings.EqualFold(rec.Type, "CAA") {
+			continue
+		}
+
+		caa, err := ParseCAA(rec.Value)
+		if err != nil {
+			problems = append(problems, CAAProblem{Record: rec, Problem: err.Error()})
+			continue
+		}
+
+		tag := strings.ToLower(caa.Tag)
+		if caa.Flags&^128 != 0 {
+			problems = append(problems, CAAProblem{Record: rec, Problem: fmt.Sprintf("reserved flag bits set in %d", caa.Flags)})
+		}
+		if !knownCAATags[tag] {
+			if caa.Critical() {
+				problems = append(problems, CAAProblem{Record: rec, Problem: fmt.Sprintf("critical flag set on unknown tag %s, which blocks all issuance", caa.Tag)})
+			} else {
+				problems = append(problems, CAAProblem{Record: rec, Problem: fmt.Sprintf("unknown tag %s is ignored", caa.Tag)})
+			}
+		}
+		if tag == "iodef" && !strings.HasPrefix(caa.Value, "mailto:") && !strings.HasPrefix(caa.Value, "https://") && !strings.HasPrefix(caa.Value, "http://") {
+			problems = append(problems, CAAProblem{Record: rec, Problem: fmt.Sprintf("iodef value %q is not a mailto: or http(s) URL", caa.Value)})
+		}
+
+		if tag == "issue" || tag == "issuewild" {
+			key := strings.ToLower(normalizeName(rec.Name)) + "|" + tag
+			pol, ok := policies[key]
+			if !ok {
+				pol = &policy{}
+				policies[key] = pol
+				keys = append(keys, key)
+			}
+			if strings.TrimSpace(strings.SplitN(caa.Value, ";", 2)[0]) == "" {
+				pol.deny = append(pol.deny, rec)
+			} else {
+				pol.allow = append(pol.allow, rec)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		pol := policies[key]
+		if len(pol.deny) == 0 || len(pol.allow) == 0 {
+			continue
+		}
+		for _, rec := range pol.deny {
+			problems = append(problems, CAAProblem{Record: rec, Problem: fmt.Sprintf("forbids issuance while %d other record(s) of the same tag allow it", len(pol.allow))})
+		}
+	}
+
+	return problems
+}
+
+// CheckZoneCAA fetches the records of zone and checks its CAA records with
+// CheckCAA.
+func (p *Provider) CheckZoneCAA(ctx context.Context, zone string) ([]CAAProblem, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return CheckCAA(records), nil
+}
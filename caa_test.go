@@ -0,0 +1,63 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCAA(t *testing.T) {
+	caa, err := regfish.ParseCAA(`128 issue "letsencrypt.org; validationmethods=dns-01"`)
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.CAA{Flags: 128, Tag: "issue", Value: "letsencrypt.org; validationmethods=dns-01"}, caa)
+	assert.True(t, caa.Critical())
+
+	_, err = regfish.ParseCAA(`issue "letsencrypt.org"`)
+	assert.Error(t, err)
+	_, err = regfish.ParseCAA(`256 issue "letsencrypt.org"`)
+	assert.Error(t, err)
+}
+
+func TestCheckCAAValid(t *testing.T) {
+	problems := regfish.CheckCAA([]libdns.Record{
+		{Type: "CAA", Name: "", Value: `0 issue "letsencrypt.org"`},
+		{Type: "CAA", Name: "", Value: `0 issue "sectigo.com"`},
+		{Type: "CAA", Name: "", Value: `0 issuewild ";"`},
+		{Type: "CAA", Name: "", Value: `0 iodef "mailto:security@example.com"`},
+		{Type: "A", Name: "", Value: "192.0.2.1"},
+	})
+	assert.Empty(t, problems)
+}
+
+func TestCheckZoneCAAConflicts(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 3600},
+		rfns.Record{Name: "example.com.", Type: "CAA", Data: `0 issue ";"`, TTL: 3600},
+		rfns.Record{Name: "example.com.", Type: "CAA", Data: `128 tbs "unknown"`, TTL: 3600},
+		rfns.Record{Name: "example.com.", Type: "CAA", Data: `2 issuewild "letsencrypt.org"`, TTL: 3600},
+		rfns.Record{Name: "example.com.", Type: "CAA", Data: `0 iodef "security@example.com"`, TTL: 3600},
+		rfns.Record{Name: "www.example.com.", Type: "CAA", Data: `0 issue ";"`, TTL: 3600},
+	)
+
+	problems, err := api.provider().CheckZoneCAA(context.Background(), test_zone)
+	assert.Nil(t, err)
+
+	var values []string
+	for _, problem := range problems {
+		values = append(values, problem.Record.Value)
+	}
+	assert.Equal(t, []string{
+		`128 tbs "unknown"`,
+		`2 issuewild "letsencrypt.org"`,
+		`0 iodef "security@example.com"`,
+		`0 issue ";"`,
+	}, values)
+	if assert.Len(t, problems, 4) {
+		assert.Contains(t, problems[0].Problem, "blocks all issuance")
+		assert.Equal(t, "", problems[3].Record.Name)
+	}
+}
@@ -0,0 +1,93 @@
+package regfish
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// cacheEntry holds the records of a zone as fetched at a point in time.
+type cacheEntry struct {
+	records []rfns.Record
+	fetched time.Time
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context that makes reads through it bypass the
+// cache enabled by Provider.CacheTTL and fetch records from regfish. The
+// fetched records still refresh the cache. Use it for checks that must not
+// see stale data, such as verifying an ACME challenge record.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// zoneKey returns the key under which records of zone are cached and the
+// zone is locked, so that spellings of a zone differing in case or the
+// trailing dot refer to the same zone.
+func zoneKey(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+// cachedRecords returns the cached records of zone, if caching is enabled,
+// not bypassed by ctx, and the records have not expired.
+func (p *Provider) cachedRecords(ctx context.Context, zone string) ([]rfns.Record, bool) {
+	if p.CacheTTL <= 0 {
+		return nil, false
+	}
+	if bypass, _ := ctx.Value(noCacheKey{}).(bool); bypass {
+		return nil, false
+	}
+
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	entry, ok := p.cache[zoneKey(zone)]
+	if !ok || p.clock().Now().Sub(entry.fetched) > p.CacheTTL {
+		return nil, false
+	}
+	return entry.records, true
+}
+
+// cacheGeneration returns the generation of the cache of zone, which
+// invalidateCache advances. Take it before fetching records to cache.
+func (p *Provider) cacheGeneration(zone string) uint64 {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	return p.cacheGenerations[zoneKey(zone)]
+}
+
+// cacheRecords stores the records of zone in the cache, if it is enabled.
+// The records are discarded if the cache of zone was invalidated since
+// generation, as taken with cacheGeneration before they were fetched,
+// since a read running alongside a write with UnlockedReads may otherwise
+// put back what the write made stale.
+func (p *Provider) cacheRecords(zone string, records []rfns.Record, generation uint64) {
+	if p.CacheTTL <= 0 {
+		return
+	}
+
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	key := zoneKey(zone)
+	if p.cacheGenerations[key] != generation {
+		return
+	}
+	if p.cache == nil {
+		p.cache = make(map[string]cacheEntry)
+	}
+	p.cache[key] = cacheEntry{records: records, fetched: p.clock().Now()}
+}
+
+// invalidateCache drops the cached records of zone.
+func (p *Provider) invalidateCache(zone string) {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	key := zoneKey(zone)
+	delete(p.cache, key)
+	if p.cacheGenerations == nil {
+		p.cacheGenerations = make(map[string]uint64)
+	}
+	p.cacheGenerations[key]++
+}
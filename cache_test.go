@@ -0,0 +1,153 @@
+package regfish_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRecordsCache(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	p.CacheTTL = time.Minute
+	ctx := context.Background()
+
+	records, cached, err := p.GetRecordsWithCacheStatus(ctx, test_zone)
+	assert.Nil(t, err)
+	assert.False(t, cached)
+	assert.Len(t, records, 1)
+
+	records, cached, err = p.GetRecordsWithCacheStatus(ctx, test_zone)
+	assert.Nil(t, err)
+	assert.True(t, cached)
+	assert.Len(t, records, 1)
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+
+	t.Run("Bypassed with WithoutCache", func(t *testing.T) {
+		_, cached, err := p.GetRecordsWithCacheStatus(regfish.WithoutCache(ctx), test_zone)
+		assert.Nil(t, err)
+		assert.False(t, cached)
+		assert.Equal(t, 2, api.count("GET /dns/example.com/rr"))
+	})
+
+	t.Run("Stale after changes made elsewhere", func(t *testing.T) {
+		api.mu.Lock()
+		api.add(rfns.Record{Name: "mail.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300})
+		api.mu.Unlock()
+
+		records, cached, err := p.GetRecordsWithCacheStatus(ctx, test_zone)
+		assert.Nil(t, err)
+		assert.True(t, cached)
+		assert.Len(t, records, 1)
+	})
+
+	t.Run("Invalidated by writes", func(t *testing.T) {
+		_, err := p.AppendRecords(ctx, test_zone, []libdns.Record{{Name: "new", Type: "A", Value: "10.0.0.3"}})
+		assert.Nil(t, err)
+
+		records, cached, err := p.GetRecordsWithCacheStatus(ctx, test_zone)
+		assert.Nil(t, err)
+		assert.False(t, cached)
+		assert.Len(t, records, 3)
+	})
+}
+
+func TestGetRecordsCacheDisabled(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+
+	for i := 0; i < 2; i++ {
+		_, cached, err := p.GetRecordsWithCacheStatus(context.Background(), test_zone)
+		assert.Nil(t, err)
+		assert.False(t, cached)
+	}
+	assert.Equal(t, 2, api.count("GET /dns/example.com/rr"))
+}
+
+func TestSetRecordsSkipUnchanged(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "MX", Data: "mx.example.com.", TTL: 300, Priority: intPtr(10)},
+	)
+	p := api.provider()
+	p.SkipUnchanged = true
+	p.CacheTTL = time.Minute
+	ctx := context.Background()
+
+	records := []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{Name: "", Type: "MX", Value: "mx.example.com.", TTL: 5 * time.Minute, Priority: 10},
+	}
+	for i := 0; i < 3; i++ {
+		result, err := p.SetRecords(ctx, test_zone, records)
+		assert.Nil(t, err)
+		if assert.Len(t, result, 2) {
+			assert.Equal(t, "1001", result[0].ID)
+			assert.Equal(t, 10, result[1].Priority)
+		}
+	}
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1002"))
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+
+	records[0].TTL = time.Hour
+	_, err := p.SetRecords(ctx, test_zone, records)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, api.count("PATCH /dns/rr/1001"))
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1002"))
+
+	// The write invalidated the cache, so the next call reads the zone
+	// again, and finds nothing left to write.
+	_, err = p.SetRecords(ctx, test_zone, records)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, api.count("PATCH /dns/rr/1001"))
+}
+
+func TestGetRecordsCacheUnlockedReadDuringWrite(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	p.CacheTTL = time.Minute
+	p.UnlockedReads = true
+	ctx := context.Background()
+
+	// The first read is answered before the write, but the answer arrives
+	// only after the write invalidated the cache.
+	read, release := make(chan struct{}), make(chan struct{})
+	var held int32
+	api.after = func(r *http.Request) {
+		if r.Method == http.MethodGet && atomic.CompareAndSwapInt32(&held, 0, 1) {
+			close(read)
+			<-release
+		}
+	}
+	done := make(chan []libdns.Record)
+	go func() {
+		records, err := p.GetRecords(ctx, test_zone)
+		assert.Nil(t, err)
+		done <- records
+	}()
+	<-read
+
+	_, err := p.AppendRecords(ctx, test_zone, []libdns.Record{
+		{Name: "api", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	close(release)
+	assert.Len(t, <-done, 1)
+
+	records, cached, err := p.GetRecordsWithCacheStatus(ctx, test_zone)
+	assert.Nil(t, err)
+	assert.False(t, cached)
+	assert.Len(t, records, 2)
+}
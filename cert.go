@@ -0,0 +1,117 @@
+package regfish
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CERT is the parsed value of a CERT record, which stores a certificate
+// or a certificate revocation list.
+type CERT struct {
+	// Type is the certificate type, such as 1 for X.509 (PKIX) or 3 for
+	// OpenPGP (PGP).
+	Type      uint16
+	KeyTag    uint16
+	Algorithm uint8
+
+	// Certificate is the certificate or CRL.
+	Certificate []byte
+}
+
+// certTypes are the mnemonics of the CERT certificate types of RFC 4398.
+var certTypes = map[string]uint16{
+	"PKIX":    1,
+	"SPKI":    2,
+	"PGP":     3,
+	"IPKIX":   4,
+	"ISPKI":   5,
+	"IPGP":    6,
+	"ACPKIX":  7,
+	"IACPKIX": 8,
+	"URI":     253,
+	"OID":     254,
+}
+
+// dnssecAlgorithms are the mnemonics of DNSSEC algorithms, which the
+// algorithm of a CERT record may be given as.
+var dnssecAlgorithms = map[string]uint8{
+	"RSAMD5":             1,
+	"DH":                 2,
+	"DSA":                3,
+	"RSASHA1":            5,
+	"DSA-NSEC3-SHA1":     6,
+	"RSASHA1-NSEC3-SHA1": 7,
+	"RSASHA256":          8,
+	"RSASHA512":          10,
+	"ECC-GOST":           12,
+	"ECDSAP256SHA256":    13,
+	"ECDSAP384SHA384":    14,
+	"ED25519":            15,
+	"ED448":              16,
+}
+
+// ParseCERT parses the value of a CERT record, such as
+// "PKIX 0 0 MIIB...". The type and algorithm may be given as numbers or
+// mnemonics, and the certificate may be split by spaces.
+func ParseCERT(value string) (CERT, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return CERT{}, fmt.Errorf("malformed CERT value %q; expected: '<type> <key tag> <algorithm> <certificate>'", value)
+	}
+
+	certType, ok := certTypes[strings.ToUpper(fields[0])]
+	if !ok {
+		n, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return CERT{}, fmt.Errorf("invalid CERT type %s", fields[0])
+		}
+		certType = uint16(n)
+	}
+	keyTag, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return CERT{}, fmt.Errorf("invalid CERT key tag %s: %v", fields[1], err)
+	}
+	algorithm, ok := dnssecAlgorithms[strings.ToUpper(fields[2])]
+	if !ok {
+		n, err := strconv.ParseUint(fields[2], 10, 8)
+		if err != nil {
+			return CERT{}, fmt.Errorf("invalid CERT algorithm %s", fields[2])
+		}
+		algorithm = uint8(n)
+	}
+	certificate, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return CERT{}, fmt.Errorf("invalid CERT certificate: %v", err)
+	}
+	if len(certificate) == 0 {
+		return CERT{}, fmt.Errorf("CERT certificate is empty")
+	}
+
+	return CERT{
+		Type:        certType,
+		KeyTag:      uint16(keyTag),
+		Algorithm:   algorithm,
+		Certificate: certificate,
+	}, nil
+}
+
+// String returns the value of the CERT record, with type and algorithm as
+// numbers and the certificate in base64 as a single field.
+func (c CERT) String() string {
+	return fmt.Sprintf("%d %d %d %s", c.Type, c.KeyTag, c.Algorithm, base64.StdEncoding.EncodeToString(c.Certificate))
+}
+
+// ParseOPENPGPKEY parses the value of an OPENPGPKEY record, an OpenPGP
+// transferable public key in base64, which may be split by spaces.
+func ParseOPENPGPKEY(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPENPGPKEY key: %v", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("OPENPGPKEY key is empty")
+	}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package regfish_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCERT(t *testing.T) {
+	der := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x30, 0x82}, 300))
+
+	cert, err := regfish.ParseCERT("PKIX 12345 RSASHA256 " + der[:100] + " " + der[100:])
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(1), cert.Type)
+	assert.Equal(t, uint16(12345), cert.KeyTag)
+	assert.Equal(t, uint8(8), cert.Algorithm)
+	assert.Len(t, cert.Certificate, 600)
+	assert.Equal(t, "1 12345 8 "+der, cert.String())
+
+	cert, err = regfish.ParseCERT("3 0 0 " + der)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(3), cert.Type)
+
+	for _, value := range []string{"PKIX 0 0", "X509 0 0 " + der, "PKIX 0 RSA " + der, "PKIX 0 0 not-base64"} {
+		_, err := regfish.ParseCERT(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestSMIMEAAndOPENPGPKEY(t *testing.T) {
+	assert.Nil(t, regfish.ValidateRecord(libdns.Record{Type: "SMIMEA", Name: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert", Value: "3 0 1 " + testTLSAHash}))
+	assert.NotNil(t, regfish.ValidateRecord(libdns.Record{Type: "SMIMEA", Name: "x._smimecert", Value: "3 0 1 ABCD"}))
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("openpgp"), 600))
+	_, err := regfish.ParseOPENPGPKEY(key[:1000] + "\n" + key[1000:])
+	assert.Nil(t, err)
+	assert.NotNil(t, regfish.ValidateRecord(libdns.Record{Type: "OPENPGPKEY", Name: "x._openpgpkey", Value: "not base64!"}))
+
+	// Large keys survive a round trip, and are joined into a single field.
+	api := newMockAPI(t)
+	records, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Type: "OPENPGPKEY", Name: "x._openpgpkey", Value: key[:1000] + " " + key[1000:], TTL: time.Hour},
+		{Type: "SMIMEA", Name: "x._smimecert", Value: "3 0 1 " + strings.ToLower(testTLSAHash), TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, key, records[0].Value)
+		assert.Equal(t, "3 0 1 "+strings.ToUpper(testTLSAHash), records[1].Value)
+	}
+}
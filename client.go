@@ -2,61 +2,772 @@ package regfish
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/libdns/libdns"
 	rfns "github.com/regfish/regfish-dnsapi-go"
 )
 
-// init initializes the provider.
-func (p *Provider) init(ctx context.Context) {
+// init initializes the provider. It fails with ErrMissingToken if no API
+// token is set and with ErrInvalidToken if it is malformed, before any
+// request is made.
+func (p *Provider) init(ctx context.Context) error {
+	if p.APIToken == "" {
+		return ErrMissingToken
+	}
+	if !validToken(p.APIToken) {
+		return ErrInvalidToken
+	}
+	if err := p.checkRetryPolicies(); err != nil {
+		return err
+	}
+
 	p.once.Do(func() {
 		p.client = *rfns.NewClient(p.APIToken)
+		if p.BaseURL != "" {
+			p.client.BaseURL = strings.TrimRight(p.BaseURL, "/")
+		}
+
+		limit := p.MaxConcurrentRequests
+		if limit <= 0 {
+			limit = defaultMaxConcurrentRequests
+		}
+		p.requests = make(chan struct{}, limit)
+	})
+	return nil
+}
+
+// validToken reports whether token consists of printable ASCII characters
+// other than space only, as regfish API keys do.
+func validToken(token string) bool {
+	for i := 0; i < len(token); i++ {
+		if token[i] <= ' ' || token[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire blocks until a request to the regfish API may be made without
+// exceeding MaxConcurrentRequests, or ctx is done. The returned function
+// must be called once the request is finished.
+func (p *Provider) acquire(ctx context.Context) (func(), error) {
+	select {
+	case p.requests <- struct{}{}:
+		return func() { <-p.requests }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// zoneMutex returns the mutex guarding zone. Each zone has its own, so
+// that writes to different zones do not wait for each other.
+func (p *Provider) zoneMutex(zone string) *sync.RWMutex {
+	p.zoneMutexesMutex.Lock()
+	defer p.zoneMutexesMutex.Unlock()
+	if p.zoneMutexes == nil {
+		p.zoneMutexes = make(map[string]*sync.RWMutex)
+	}
+	key := zoneKey(zone)
+	if ascii, err := p.toAPIName(zone); err == nil {
+		key = zoneKey(ascii)
+	}
+	mutex, ok := p.zoneMutexes[key]
+	if !ok {
+		mutex = &sync.RWMutex{}
+		p.zoneMutexes[key] = mutex
+	}
+	return mutex
+}
+
+// lock write-locks the mutex of zone, or returns the error of ctx if ctx
+// is done first. The caller must call the returned function to unlock the
+// mutex if lock succeeds.
+func (p *Provider) lock(ctx context.Context, zone string) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mutex := p.zoneMutex(zone)
+	if mutex.TryLock() {
+		return mutex.Unlock, nil
+	}
+	if err := lockContext(ctx, mutex.Lock, mutex.Unlock); err != nil {
+		return nil, err
+	}
+	return mutex.Unlock, nil
+}
+
+// rlock read-locks the mutex of zone like lock.
+func (p *Provider) rlock(ctx context.Context, zone string) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mutex := p.zoneMutex(zone)
+	if mutex.TryRLock() {
+		return mutex.RUnlock, nil
+	}
+	if err := lockContext(ctx, mutex.RLock, mutex.RUnlock); err != nil {
+		return nil, err
+	}
+	return mutex.RUnlock, nil
+}
+
+// lockContext calls lock, giving up once ctx is done. sync.RWMutex cannot
+// be waited for with a context, so the lock is taken in a goroutine, which
+// releases it again if it is acquired after the caller gave up.
+func lockContext(ctx context.Context, lock, unlock func()) error {
+	locked := make(chan struct{})
+	go func() {
+		lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// clientFor returns a copy of the regfish client whose requests are bound to
+// ctx, so that they are canceled when ctx is done. The regfish client
+// itself takes no context.
+func (p *Provider) clientFor(ctx context.Context) *rfns.Client {
+	client := p.client
+	httpClient := *p.client.Client
+	httpClient.Transport = contextTransport{ctx: ctx, base: httpClient.Transport, clock: p.clock()}
+	client.Client = &httpClient
+	return &client
+}
+
+// contextTransport attaches a context to the requests it sends. Error
+// responses are turned into an *APIError, which the regfish client passes
+// on wrapped, instead of reducing them to their status code; clock gives
+// the time a Retry-After date is relative to.
+type contextTransport struct {
+	ctx   context.Context
+	base  http.RoundTripper
+	clock Clock
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req.WithContext(t.ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newAPIError(resp, t.clock.Now())
+	}
+	return resp, nil
+}
+
+// withTimeout returns ctx limited to timeout, if timeout is positive. A
+// deadline of ctx that is earlier still applies.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// getRecords fetches all records of zone from the regfish API.
+func (p *Provider) getRecords(ctx context.Context, zone string) ([]rfns.Record, error) {
+	var records []rfns.Record
+	err := p.do(ctx, true, func(client *rfns.Client) (err error) {
+		records, err = client.GetRecordsByDomain(zone)
+		return err
+	})
+	return records, err
+}
+
+// knownFields are the JSON fields of a record that rfns.Record holds.
+var knownFields = []string{"id", "name", "type", "data", "ttl", "priority", "annotation", "tag", "flags"}
+
+// getRecordDetails fetches all records of zone from the regfish API like
+// getRecords, but keeps the fields rfns.Record has no room for in the
+// Extra field of each RecordDetail.
+func (p *Provider) getRecordDetails(ctx context.Context, zone string) ([]RecordDetail, error) {
+	var body []byte
+	err := p.do(ctx, true, func(client *rfns.Client) (err error) {
+		body, err = client.Request(http.MethodGet, fmt.Sprintf("/dns/%s/rr", zone), nil, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Response []json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	details := make([]RecordDetail, 0, len(response.Response))
+	for _, raw := range response.Response {
+		var rec rfns.Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal record: %w", err)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal record: %w", err)
+		}
+		for _, field := range knownFields {
+			delete(fields, field)
+		}
+
+		detail := newRecordDetail(rec, zone)
+		if len(fields) > 0 {
+			detail.Extra = fields
+		}
+		details = append(details, detail)
+	}
+	return details, nil
+}
+
+// createRecord creates rec through the regfish API. In dry-run mode, it
+// returns rec without an ID instead.
+func (p *Provider) createRecord(ctx context.Context, rec rfns.Record) (rfns.Record, error) {
+	if p.dryRun(ctx) {
+		rec.ID = 0
+		return rec, nil
+	}
+
+	var created rfns.Record
+	err := p.do(ctx, false, func(client *rfns.Client) (err error) {
+		created, err = client.CreateRecord(rec)
+		return err
+	})
+	if err != nil {
+		return created, err
+	}
+	if err := p.checkCreated(rec, created); err != nil {
+		return created, err
+	}
+
+	return created, p.verifyWrite(ctx, rec, created)
+}
+
+// checkCreated compares the record regfish reports as created to the one
+// requested, as CreateMismatch says: it must have an ID, and the same
+// name and type.
+func (p *Provider) checkCreated(requested, created rfns.Record) error {
+	if p.CreateMismatch == MismatchIgnore {
+		return nil
+	}
+
+	var msg string
+	switch {
+	case created.ID == 0:
+		msg = fmt.Sprintf("regfish returned no ID for created record %s of type %s", requested.Name, requested.Type)
+	case !strings.EqualFold(strings.TrimSuffix(created.Name, "."), strings.TrimSuffix(requested.Name, ".")) || !strings.EqualFold(created.Type, requested.Type):
+		msg = fmt.Sprintf("regfish created record ID %d as %s of type %s instead of %s of type %s", created.ID, created.Name, created.Type, requested.Name, requested.Type)
+	default:
+		return nil
+	}
+
+	if p.CreateMismatch == MismatchWarn {
+		p.logger().Printf("regfish: %s", msg)
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// updateRecord updates the record with the given ID through the regfish
+// API. In dry-run mode, it returns rec with that ID instead.
+func (p *Provider) updateRecord(ctx context.Context, rrid int, rec rfns.Record) (rfns.Record, error) {
+	if p.dryRun(ctx) {
+		rec.ID = rrid
+		return rec, nil
+	}
+
+	var updated rfns.Record
+	err := p.do(ctx, true, func(client *rfns.Client) (err error) {
+		updated, err = client.UpdateRecordById(rrid, rec)
+		return err
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	return updated, p.verifyWrite(ctx, rec, updated)
+}
+
+// getRecord fetches the record with the given ID from the regfish API.
+func (p *Provider) getRecord(ctx context.Context, rrid int) (rfns.Record, error) {
+	var rec rfns.Record
+	err := p.do(ctx, true, func(client *rfns.Client) (err error) {
+		rec, err = client.GetRecord(rrid)
+		return err
+	})
+	return rec, err
+}
+
+// verifyWrite checks, if VerifyWrites is set, that regfish stored the
+// record written as sent by reading it back. It returns an error if the
+// data or priority differ; a different TTL is handled as TTLMismatch says.
+func (p *Provider) verifyWrite(ctx context.Context, sent, written rfns.Record) error {
+	if !p.VerifyWrites {
+		return nil
+	}
+
+	stored, err := p.getRecord(ctx, written.ID)
+	if err != nil {
+		return fmt.Errorf("failed to verify record ID %d: %w", written.ID, err)
+	}
+	if stored.Data != sent.Data {
+		return fmt.Errorf("record ID %d was stored with data %s instead of %s", written.ID, p.errorData(sent.Type, stored.Data), p.errorData(sent.Type, sent.Data))
+	}
+	if sent.TTL != 0 && stored.TTL != sent.TTL {
+		msg := fmt.Sprintf("record ID %d was stored with TTL %d instead of %d", written.ID, stored.TTL, sent.TTL)
+		switch p.TTLMismatch {
+		case MismatchWarn:
+			p.logger().Printf("regfish: %s", msg)
+		case MismatchError:
+			return errors.New(msg)
+		}
+	}
+	if sent.Priority != nil && getPriority(stored.Priority) != *sent.Priority {
+		return fmt.Errorf("record ID %d was stored with priority %d instead of %d", written.ID, getPriority(stored.Priority), *sent.Priority)
+	}
+	return nil
+}
+
+// deleteRecord deletes the record with the given ID through the regfish
+// API. In dry-run mode, it does nothing.
+func (p *Provider) deleteRecord(ctx context.Context, rrid int) error {
+	if p.dryRun(ctx) {
+		return nil
+	}
+
+	// A retried delete that finds the record gone was most likely made by
+	// an earlier attempt whose response was lost.
+	attempts := 0
+	err := p.do(ctx, true, func(client *rfns.Client) error {
+		attempts++
+		return client.DeleteRecord(rrid)
 	})
+	if attempts > 1 && statusCode(err) == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// waitForWave blocks until the next wave of AppendRecords may start. In
+// dry-run mode no requests are made, so it does not wait.
+func (p *Provider) waitForWave(ctx context.Context) error {
+	if p.dryRun(ctx) {
+		return nil
+	}
+	if p.AppendWaveLimiter != nil {
+		return p.AppendWaveLimiter.Wait(ctx)
+	}
+
+	return p.sleep(ctx, defaultWaveInterval)
+}
+
+// reportAppendProgress calls AppendProgress, if set.
+func (p *Provider) reportAppendProgress(done, total int) {
+	if p.AppendProgress != nil && total > 0 {
+		p.AppendProgress(done, total)
+	}
 }
 
 // fqdn returns a fully qualified domain name.
-func (p *Provider) fqdn(name, zone string) string {
-	name = strings.TrimRight(name, ".")
+func fqdn(name, zone string) string {
 	zone = strings.TrimRight(zone, ".")
-	if !strings.HasSuffix(name, zone) {
-		name += "." + zone
+	name = stripZone(name, zone)
+	if name == "" {
+		return zone + "."
 	}
-	return name + "."
+	return name + "." + zone + "."
 }
 
-// upserRecords adds or updates records to the zone. It returns the records that were added or updated.
-func (p *Provider) upsertRecord(record libdns.Record, zone string) (*rfns.Record, error) {
+// stripZone removes an accidental zone suffix from a name that should be
+// relative to the zone, e.g. "www.example.com" in zone "example.com"
+// becomes "www". Names that merely end in the same characters, such as
+// "myexample.com", are left alone. The apex markers "" and "@" both
+// become "".
+func stripZone(name, zone string) string {
+	name = strings.TrimRight(name, ".")
+	zone = strings.TrimRight(zone, ".")
+	if name == "@" || strings.EqualFold(name, zone) {
+		return ""
+	}
+	if suffix := "." + zone; len(name) > len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+		return name[:len(name)-len(suffix)]
+	}
+	return name
+}
 
-	records, err := p.client.GetRecordsByDomain(zone)
+// deleteRecords deletes the records from the zone, looking them up in
+// all_records. It returns the records that were deleted, also if it fails
+// part way. Unless ctx was made with WithForceDelete, no record is deleted
+// if any of them is protected by isProtected.
+func (p *Provider) deleteRecords(ctx context.Context, zone string, all_records []rfns.Record, records []libdns.Record) ([]libdns.Record, error) {
+	ops, err := p.resolveDeletes(ctx, zone, all_records, records)
 	if err != nil {
 		return nil, err
 	}
 
-	update_rec := rfns.Record{
-		Name:     p.fqdn(record.Name, zone),
-		Type:     record.Type,
-		Data:     record.Value,
-		TTL:      int(record.TTL.Seconds()),
-		Priority: &record.Priority,
+	var deletedRecords []libdns.Record
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return deletedRecords, fmt.Errorf("failed to delete record ID %d: %w", op.rrid, err)
+		}
+		err := p.deleteRecord(ctx, op.rrid)
+		if err != nil {
+			return deletedRecords, fmt.Errorf("failed to delete record ID %d: %w", op.rrid, err)
+		}
+		deletedRecords = append(deletedRecords, op.record)
+	}
+
+	return deletedRecords, nil
+}
+
+// deleteOp is a deletion planned by resolveDeletes: the record with ID
+// rrid, reported as record once deleted.
+type deleteOp struct {
+	rrid   int
+	record libdns.Record
+}
+
+// resolveDeletes looks up the records to delete in all_records, or returns
+// an error if any of them cannot be deleted: it has an invalid ID, it is a
+// forwarding record, it is not found, or it is protected, including glue
+// checked by checkGlue, and ctx was not made with WithForceDelete. A
+// record without ID and value stands for all records of its name and
+// type, which are reported as found; if there are none, nothing is
+// deleted for it, and it is no error. With IgnoreMissingOnDelete set,
+// neither are other records not found.
+func (p *Provider) resolveDeletes(ctx context.Context, zone string, all_records []rfns.Record, records []libdns.Record) ([]deleteOp, error) {
+	if err := checkRecordIDs(records); err != nil {
+		return nil, err
+	}
+	existing := newRecordIndex(all_records, zone)
+	if !forceDelete(ctx) {
+		for _, record := range records {
+			protected := isProtected(record.Name, record.Type, zone)
+			if rec, ok := existing.byRecordID(record); ok && isProtected(rec.Name, rec.Type, zone) {
+				protected = true
+			}
+			if protected {
+				return nil, protectedError(record.Type, zone)
+			}
+		}
+	}
+
+	ops := make([]deleteOp, 0, len(records))
+	scheduled := make(map[int]bool)
+	for _, record := range records {
+		if IsForwardingRecord(record) {
+			return nil, fmt.Errorf("record %s of type %s is a forwarding record and cannot be deleted through the DNS API", record.Name, record.Type)
+		}
+
+		all := record.ID == "" && record.Value == ""
+		targets := existing.deleteTargets(record)
+		if len(targets) == 0 && !all && !p.IgnoreMissingOnDelete {
+			return nil, fmt.Errorf("record %s of type %s with data %s not found", record.Name, record.Type, p.errorData(record.Type, record.Value))
+		}
+		for _, rec := range targets {
+			op := deleteOp{rrid: rec.ID, record: record}
+			if all {
+				if scheduled[rec.ID] {
+					continue
+				}
+				op.record = convertToLibdnsRecord(rec, zone)
+			}
+			scheduled[rec.ID] = true
+			ops = append(ops, op)
+		}
+	}
+
+	if !forceDelete(ctx) {
+		if err := checkGlue(all_records, scheduled, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+// sensitiveTypes are record types whose data may hold secrets or key
+// material.
+var sensitiveTypes = map[string]bool{
+	"TXT":        true,
+	"SPF":        true,
+	"TLSA":       true,
+	"SMIMEA":     true,
+	"SSHFP":      true,
+	"DNSKEY":     true,
+	"CDNSKEY":    true,
+	"DS":         true,
+	"CDS":        true,
+	"CERT":       true,
+	"OPENPGPKEY": true,
+}
+
+// errorData returns record data for use in an error message. With
+// RedactSensitive set, data of sensitive types is replaced by its length.
+func (p *Provider) errorData(recordType, data string) string {
+	if p.RedactSensitive && sensitiveTypes[strings.ToUpper(recordType)] {
+		return fmt.Sprintf("[redacted, %d bytes]", len(data))
+	}
+	return data
+}
+
+// sameName reports whether two record names denote the same domain name
+// in zone. DNS names are case-insensitive, so casing is ignored.
+func sameName(a, b, zone string) bool {
+	return strings.EqualFold(fqdn(a, zone), fqdn(b, zone))
+}
+
+// recordKey returns the key identifying the record set of a name and type.
+// Names are case-insensitive, so the name is lowercased.
+func recordKey(name, recordType string) string {
+	return strings.ToLower(name) + "|" + strings.ToUpper(recordType)
+}
+
+// checkRecords returns an error if any of the records cannot be written:
+// IDs must be regfish record IDs, a name can hold only one CNAME or DNAME
+// record, forwarding records are managed by regfish outside of DNS, SOA
+// records are maintained by regfish, with StrictPriority set, records
+// must not carry a priority their type does not have, and with
+// PreValidate set, records must pass ValidateRecord.
+// It runs before any change is made, so a bad record anywhere in a batch
+// leaves the zone untouched.
+func (p *Provider) checkRecords(records []libdns.Record) error {
+	if err := checkRecordIDs(records); err != nil {
+		return err
+	}
+	if err := checkSingletons(records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if p.PreValidate {
+			if err := ValidateRecord(record); err != nil {
+				return err
+			}
+		}
+		if IsForwardingRecord(record) {
+			return fmt.Errorf("record %s of type %s is a forwarding record and cannot be changed through the DNS API", record.Name, record.Type)
+		}
+		if strings.EqualFold(record.Type, "SOA") {
+			return fmt.Errorf("record %s of type SOA is maintained by regfish and cannot be written", record.Name)
+		}
+		if p.StrictPriority && record.Priority != 0 && !hasPriority(record.Type) {
+			return fmt.Errorf("record %s of type %s cannot have a priority (got %d)", record.Name, record.Type, record.Priority)
+		}
+	}
+	return nil
+}
+
+// checkSingletons returns an error if records hold two CNAME or two DNAME
+// records of the same name with different targets. A name can hold only
+// one of each, so writing both would leave the name with either target,
+// depending on the order of the writes.
+func checkSingletons(records []libdns.Record) error {
+	targets := make(map[string]string)
+	for _, record := range records {
+		switch strings.ToUpper(record.Type) {
+		case "CNAME", "DNAME":
+		default:
+			continue
+		}
+		key := recordKey(normalizeName(record.Name), record.Type)
+		target := normalizeValue(record.Type, record.Value)
+		if other, ok := targets[key]; ok && other != target {
+			return fmt.Errorf("record %s of type %s is given with the targets %s and %s, but a name can only hold one", record.Name, record.Type, other, target)
+		}
+		targets[key] = target
 	}
+	return nil
+}
 
-	for _, rec := range records {
-		if fmt.Sprintf("%d", rec.ID) == record.ID || (p.fqdn(rec.Name, zone) == p.fqdn(record.Name, zone) && rec.Type == record.Type) {
-			updatedRecord, err := p.client.UpdateRecordById(rec.ID, update_rec)
-			return &updatedRecord, err
+// checkRecordsPerName returns an error if creating records in the zone
+// would leave more than MaxRecordsPerName records at any name, counting
+// the records of the zone that stay live, which the caller has read.
+// Records that update a live record are not among records.
+func (p *Provider) checkRecordsPerName(live []rfns.Record, records []libdns.Record, zone string) error {
+	if p.MaxRecordsPerName <= 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, rec := range live {
+		counts[strings.ToLower(fqdn(rec.Name, zone))]++
+	}
+
+	for _, record := range records {
+		name := strings.ToLower(fqdn(record.Name, zone))
+		counts[name]++
+		if counts[name] > p.MaxRecordsPerName {
+			return fmt.Errorf("record %s of type %s would exceed the limit of %d records per name", record.Name, record.Type, p.MaxRecordsPerName)
 		}
 	}
 
-	createdRecord, err := p.client.CreateRecord(update_rec)
+	return nil
+}
+
+// plannedCreates returns those of records that SetRecords creates rather
+// than updates in the zone with the existing records, picking the records
+// to update as upsertRecord does. Records that fail to pick one are left
+// out; writing them fails.
+func plannedCreates(existing []rfns.Record, records []libdns.Record, zone string) []libdns.Record {
+	index := newRecordIndex(existing, zone)
+	index.claim(records)
+
+	var created []libdns.Record
+	for i, record := range records {
+		target, ok, err := index.upsertTarget(record)
+		if err != nil {
+			continue
+		}
+		rec := convertFromLibdnsRecord(record, zone)
+		if ok {
+			rec.ID = target.ID
+		} else {
+			// Stand in for the ID regfish would assign.
+			rec.ID = -(i + 1)
+			created = append(created, record)
+		}
+		index.put(rec)
+		index.claimed[rec.ID] = true
+	}
+	return created
+}
+
+// upsertRecord adds or updates a record in the zone, looking up the record
+// to update in existing, the records of the zone as last read. It returns
+// the record that was added or updated and puts it into existing. If the
+// zone changed since existing was read, so that the record to update is
+// gone or the record to create already exists, the zone is read again and
+// the write retried, up to the attempts of the retry policy of the record
+// type in total. Retries are delayed by retryDelay.
+func (p *Provider) upsertRecord(ctx context.Context, existing *recordIndex, record libdns.Record, zone string) (*rfns.Record, error) {
+	var rec *rfns.Record
+	var err error
+	attempts := p.retryPolicy(record.Type).Attempts
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if werr := p.waitForRetry(ctx, record.Type, attempt); werr != nil {
+				return nil, werr
+			}
+			records, ferr := p.getRecordsForUpsert(ctx, zone)
+			if ferr != nil {
+				return nil, ferr
+			}
+			claimed := existing.claimed
+			*existing = *newRecordIndex(records, zone)
+			existing.claimed = claimed
+		}
+		rec, err = p.tryUpsertRecord(ctx, existing, record, zone)
+		if err == nil || !isConflict(err) {
+			break
+		}
+	}
+	if err == nil {
+		existing.put(*rec)
+		existing.claimed[rec.ID] = true
+	}
+	return rec, err
+}
+
+// getRecordsForUpsert fetches the records of zone to find those to update.
+// With RefetchEmptyZone set, an empty zone is fetched a second time, as
+// regfish may transiently return no records, which would make upserts
+// create duplicates instead of updating.
+func (p *Provider) getRecordsForUpsert(ctx context.Context, zone string) ([]rfns.Record, error) {
+	records, err := p.getRecords(ctx, zone)
+	if err != nil || len(records) > 0 || !p.RefetchEmptyZone {
+		return records, err
+	}
+	return p.getRecords(ctx, zone)
+}
+
+// tryUpsertRecord makes a single attempt at upsertRecord.
+func (p *Provider) tryUpsertRecord(ctx context.Context, existing *recordIndex, record libdns.Record, zone string) (*rfns.Record, error) {
+	update_rec := convertFromLibdnsRecord(record, zone)
+
+	rec, ok, err := existing.upsertTarget(record)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		updatedRecord, err := p.updateRecord(ctx, rec.ID, update_rec)
+		return &updatedRecord, err
+	}
+
+	createdRecord, err := p.createRecord(ctx, update_rec)
 	return &createdRecord, err
 }
 
-// getPriority returns the priority of a record and 0 if it is nil.
-func getPriority(prio *int) int {
-	if prio != nil {
-		return *prio
+// unchangedRecord returns the record in existing that upsertRecord would
+// update for record, and reports whether it already holds exactly what
+// record would be written as.
+func unchangedRecord(existing *recordIndex, record libdns.Record, zone string) (rfns.Record, bool) {
+	if rec, ok, err := existing.upsertTarget(record); ok && err == nil {
+		return rec, sameRecord(rec, record, zone)
 	}
-	return 0
+	return rfns.Record{}, false
+}
+
+// isConflict reports whether err is a regfish API error indicating that
+// the zone changed concurrently: the record was not found (404) or already
+// exists (409).
+func isConflict(err error) bool {
+	code := statusCode(err)
+	return code == http.StatusNotFound || code == http.StatusConflict
+}
+
+// statusCode returns the HTTP status code of a failed regfish API request,
+// or 0 if err does not carry one. Errors that are no *APIError only
+// report the code as part of the error message.
+func statusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatus
+	}
+	msg := err.Error()
+	idx := strings.LastIndex(msg, "status code ")
+	if idx < 0 {
+		return 0
+	}
+	var code int
+	if _, err := fmt.Sscanf(msg[idx:], "status code %d", &code); err != nil {
+		return 0
+	}
+	return code
+}
+
+// sortRecords sorts records by name, type and value.
+func sortRecords(records []libdns.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].Value < records[j].Value
+	})
 }
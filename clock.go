@@ -0,0 +1,46 @@
+package regfish
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits. The Provider uses it for everything it
+// times: the cache, pauses between append waves, retry delays and
+// propagation checks. Tests can substitute a fake clock to run these
+// without waiting.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once d has
+	// elapsed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clock returns Provider.Clock, or the real clock if it is nil.
+func (p *Provider) clock() Clock {
+	if p.Clock != nil {
+		return p.Clock
+	}
+	return realClock{}
+}
+
+// sleep blocks for d on the clock of the Provider, or until ctx is done.
+func (p *Provider) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-p.clock().After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
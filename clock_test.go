@@ -0,0 +1,111 @@
+package regfish_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a regfish.Clock whose waits return at once, advancing the
+// time instead.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.slept = append(c.slept, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestFakeClockRetries(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodPatch {
+			return http.StatusConflict, ""
+		}
+		return 0, ""
+	}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+	p.RetryBackoff = 10 * time.Second
+	p.RetryJitter = regfish.NoJitter
+
+	start := time.Now()
+	_, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second}, clock.slept)
+	assert.Equal(t, 3, api.count("PATCH /dns/rr/1001"))
+}
+
+func TestFakeClockPropagation(t *testing.T) {
+	api := newMockAPI(t)
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	_, result, err := p.AppendRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: &stubResolver{api: api, delay: 1 << 30}, Interval: time.Minute, Timeout: 5 * time.Minute})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, 6, result.Lookups)
+		assert.Equal(t, 5*time.Minute, result.Duration)
+	}
+}
+
+func TestFakeClockCache(t *testing.T) {
+	api := newMockAPI(t)
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+	p.CacheTTL = time.Minute
+
+	_, cached, err := p.GetRecordsWithCacheStatus(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.False(t, cached)
+
+	clock.Advance(59 * time.Second)
+	_, cached, _ = p.GetRecordsWithCacheStatus(context.Background(), test_zone)
+	assert.True(t, cached)
+
+	clock.Advance(2 * time.Second)
+	_, cached, _ = p.GetRecordsWithCacheStatus(context.Background(), test_zone)
+	assert.False(t, cached)
+}
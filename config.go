@@ -0,0 +1,98 @@
+package regfish
+
+import (
+	"strings"
+	"time"
+
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// Config is the effective configuration of a Provider, with defaults
+// applied to settings that were left unset.
+type Config struct {
+	// APIToken is "[redacted]" if a token is set, and empty otherwise.
+	APIToken string
+
+	BaseURL               string
+	SortRecords           bool
+	UnlockedReads         bool
+	MaxRecordsPerName     int
+	StrictPriority        bool
+	PreValidate           bool
+	UpsertAttempts        int
+	RefetchEmptyZone      bool
+	RetryBackoff          time.Duration
+	RetryJitter           Jitter
+	RetryPolicies         map[string]RetryPolicy
+	RequestAttempts       int
+	RequestBackoff        time.Duration
+	AppendWaveSize        int
+	AppendWaveInterval    time.Duration // zero if AppendWaveLimiter paces waves
+	CacheTTL              time.Duration
+	MaxConcurrentRequests int
+	IDN                   bool
+	ApexAt                bool
+	DryRun                bool
+	RedactSensitive       bool
+	SkipUnchanged         bool
+	ReplaceRRsets         bool
+	IgnoreMissingOnDelete bool
+	RollbackOnError       bool
+	VerifyWrites          bool
+	TTLMismatch           MismatchPolicy
+	CreateMismatch        MismatchPolicy
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+}
+
+// Config returns the configuration the Provider operates with, to help
+// diagnose misconfiguration. The API token is redacted.
+func (p *Provider) Config() Config {
+	cfg := Config{
+		BaseURL:               strings.TrimRight(p.BaseURL, "/"),
+		SortRecords:           p.SortRecords,
+		UnlockedReads:         p.UnlockedReads,
+		MaxRecordsPerName:     p.MaxRecordsPerName,
+		StrictPriority:        p.StrictPriority,
+		PreValidate:           p.PreValidate,
+		UpsertAttempts:        p.retryPolicy("").Attempts,
+		RefetchEmptyZone:      p.RefetchEmptyZone,
+		RetryBackoff:          p.RetryBackoff,
+		RetryJitter:           p.RetryJitter,
+		RetryPolicies:         p.RetryPolicies,
+		RequestAttempts:       p.requestAttempts(),
+		RequestBackoff:        p.requestBackoff(),
+		AppendWaveSize:        p.AppendWaveSize,
+		CacheTTL:              p.CacheTTL,
+		MaxConcurrentRequests: p.MaxConcurrentRequests,
+		IDN:                   p.IDN,
+		ApexAt:                p.ApexAt,
+		DryRun:                p.DryRun,
+		RedactSensitive:       p.RedactSensitive,
+		SkipUnchanged:         p.SkipUnchanged,
+		ReplaceRRsets:         p.ReplaceRRsets,
+		IgnoreMissingOnDelete: p.IgnoreMissingOnDelete,
+		RollbackOnError:       p.RollbackOnError,
+		VerifyWrites:          p.VerifyWrites,
+		TTLMismatch:           p.TTLMismatch,
+		CreateMismatch:        p.CreateMismatch,
+		ReadTimeout:           p.ReadTimeout,
+		WriteTimeout:          p.WriteTimeout,
+	}
+	if p.APIToken != "" {
+		cfg.APIToken = "[redacted]"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = rfns.NewClient("").BaseURL
+	}
+	if cfg.AppendWaveSize > 0 && p.AppendWaveLimiter == nil {
+		cfg.AppendWaveInterval = defaultWaveInterval
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.MaxConcurrentRequests <= 0 {
+		cfg.MaxConcurrentRequests = defaultMaxConcurrentRequests
+	}
+	return cfg
+}
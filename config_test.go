@@ -0,0 +1,44 @@
+package regfish_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	p := regfish.Provider{APIToken: "secret-token"}
+
+	assert.Equal(t, regfish.Config{
+		APIToken:              "[redacted]",
+		BaseURL:               "https://api.regfish.de",
+		UpsertAttempts:        3,
+		RetryBackoff:          100 * time.Millisecond,
+		RequestAttempts:       3,
+		RequestBackoff:        500 * time.Millisecond,
+		MaxConcurrentRequests: 4,
+	}, p.Config())
+}
+
+func TestConfigOverrides(t *testing.T) {
+	p := regfish.Provider{
+		BaseURL:               "http://localhost:8080/",
+		UpsertAttempts:        5,
+		AppendWaveSize:        50,
+		CacheTTL:              time.Minute,
+		MaxConcurrentRequests: 1,
+		DryRun:                true,
+	}
+
+	cfg := p.Config()
+	assert.Equal(t, "", cfg.APIToken)
+	assert.Equal(t, "http://localhost:8080", cfg.BaseURL)
+	assert.Equal(t, 5, cfg.UpsertAttempts)
+	assert.Equal(t, 50, cfg.AppendWaveSize)
+	assert.Equal(t, time.Second, cfg.AppendWaveInterval)
+	assert.Equal(t, time.Minute, cfg.CacheTTL)
+	assert.Equal(t, 1, cfg.MaxConcurrentRequests)
+	assert.True(t, cfg.DryRun)
+}
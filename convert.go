@@ -0,0 +1,275 @@
+package regfish
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// ToLibdnsRecord converts a record as returned by the regfish API into a
+// libdns.Record with a name relative to zone. It is meant for callers that
+// talk to the regfish client directly but want the same representation
+// the Provider returns.
+func ToLibdnsRecord(rec rfns.Record, zone string) libdns.Record {
+	return convertToLibdnsRecord(rec, zone)
+}
+
+// FromLibdnsRecord converts a libdns.Record with a name relative to zone
+// into a record as expected by the regfish API. It is the inverse of
+// ToLibdnsRecord.
+func FromLibdnsRecord(record libdns.Record, zone string) rfns.Record {
+	return convertFromLibdnsRecord(record, zone)
+}
+
+// Normalize returns record as the Provider writes it to zone, so that
+// callers can diff desired records against those read back or preview a
+// change: the name is made relative to the zone, with "" for the apex, the
+// TTL is cut to whole seconds, a priority is kept only for types that have
+// one, taken from the front of the value of MX and SRV records if
+// necessary, A and AAAA addresses are written in their shortest lower-case
+// form, with IPv4-mapped addresses of A records unmapped, and values of
+// types with binary data, such as TLSA, are brought into canonical form.
+// The ID is kept. Normalization regfish itself may apply on top, such as
+// rounding TTLs, is not predicted; VerifyWrites detects it.
+func Normalize(record libdns.Record, zone string) libdns.Record {
+	normalized := convertToLibdnsRecord(convertFromLibdnsRecord(record, zone), zone)
+	normalized.ID = record.ID
+	return normalized
+}
+
+// RecordDetail is a record together with the regfish record it was
+// converted from, which carries fields libdns.Record has no room for.
+// Record and Raw describe the same record: Record has the name relative to
+// the zone and the TTL as a duration, Raw the name and TTL as regfish
+// returned them. Fields are only ever added to RecordDetail.
+type RecordDetail struct {
+	libdns.Record
+
+	// Raw is the record as returned by the regfish API.
+	Raw rfns.Record
+
+	// Extra holds the fields of the record regfish returned that Raw has
+	// no room for, if the record was read with them.
+	Extra map[string]json.RawMessage
+}
+
+// newRecordDetail returns the RecordDetail of a regfish record in zone.
+func newRecordDetail(rec rfns.Record, zone string) RecordDetail {
+	return RecordDetail{
+		Record: convertToLibdnsRecord(rec, zone),
+		Raw:    rec,
+	}
+}
+
+// createdFields are the fields regfish might report the creation time of
+// a record in.
+var createdFields = []string{"created_at", "createdAt", "created", "creation_date"}
+
+// Created returns when regfish created the record, if the regfish API
+// returned a creation time among the Extra fields of the record, either
+// as an RFC 3339 timestamp or in seconds since the Unix epoch. The
+// regfish API does not document such a field, so it may not be available.
+func (d RecordDetail) Created() (time.Time, bool) {
+	for _, field := range createdFields {
+		raw, ok := d.Extra[field]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t, true
+			}
+			continue
+		}
+		var seconds int64
+		if err := json.Unmarshal(raw, &seconds); err == nil && seconds > 0 {
+			return time.Unix(seconds, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// convertToLibdnsRecord maps a regfish record to a libdns.Record. The name
+// is made relative to zone with stripZone rather than libdns.RelativeName,
+// which compares case-sensitively and does not respect label boundaries.
+func convertToLibdnsRecord(rec rfns.Record, zone string) libdns.Record {
+	var id string
+	if rec.ID != 0 {
+		id = strconv.Itoa(rec.ID)
+	}
+	return libdns.Record{
+		ID:       id,
+		Type:     rec.Type,
+		Name:     stripZone(rec.Name, zone),
+		Value:    recordValue(rec.Type, rec.Data),
+		TTL:      time.Duration(rec.TTL) * time.Second,
+		Priority: getPriority(rec.Priority),
+	}
+}
+
+// convertFromLibdnsRecord maps a libdns.Record to a regfish record.
+func convertFromLibdnsRecord(record libdns.Record, zone string) rfns.Record {
+	rec := rfns.Record{
+		Name: fqdn(record.Name, zone),
+		Type: record.Type,
+		Data: record.Value,
+		TTL:  int(record.TTL.Seconds()),
+	}
+	if hasPriority(record.Type) {
+		priority, data := splitPriority(record)
+		rec.Priority = &priority
+		rec.Data = data
+	}
+	rec.Data = canonicalData(record.Type, rec.Data)
+	return rec
+}
+
+// recordValue returns the value of a record of the given type holding data
+// as regfish returns it. It is the inverse of canonicalData as far as
+// callers notice: TXT values split into character-strings are joined
+// again, so that a long value reads back as it was given.
+func recordValue(recordType, data string) string {
+	if strings.EqualFold(recordType, "TXT") {
+		return joinTXT(data)
+	}
+	return data
+}
+
+// canonicalData returns data of a record of the given type as it is
+// written: long TXT values are split into character-strings, and values
+// of types with binary data, such as TLSA, DS, DNSKEY and CERT, and of
+// LOC, URI and HINFO records as well as data in the generic form of RFC
+// 3597 are brought into canonical form, such as with the target of a URI
+// record quoted, so that they compare equal to what regfish returns. Data
+// that does not parse is written as given.
+func canonicalData(recordType, data string) string {
+	if isGenericData(data) {
+		if generic, err := ParseGenericData(data); err == nil {
+			return FormatGenericData(generic)
+		}
+		return data
+	}
+
+	switch strings.ToUpper(recordType) {
+	case "A":
+		if ip, err := netip.ParseAddr(data); err == nil && ip.Unmap().Is4() {
+			return ip.Unmap().String()
+		}
+	case "AAAA":
+		if ip, err := netip.ParseAddr(data); err == nil && ip.Is6() {
+			return ip.String()
+		}
+	case "TXT":
+		return chunkTXT(data)
+	case "TLSA", "SMIMEA":
+		if t, err := ParseTLSA(data); err == nil {
+			return t.String()
+		}
+	case "CERT":
+		if c, err := ParseCERT(data); err == nil {
+			return c.String()
+		}
+	case "OPENPGPKEY":
+		if key, err := ParseOPENPGPKEY(data); err == nil {
+			return base64.StdEncoding.EncodeToString(key)
+		}
+	case "DS", "CDS":
+		if d, err := ParseDS(data); err == nil {
+			return d.String()
+		}
+	case "DNSKEY", "CDNSKEY":
+		if k, err := ParseDNSKEY(data); err == nil {
+			return k.String()
+		}
+	case "LOC":
+		if l, err := ParseLOC(data); err == nil {
+			return l.String()
+		}
+	case "HINFO":
+		if h, err := ParseHINFO(data); err == nil {
+			return h.String()
+		}
+	case "URI":
+		if weight, target, err := parseURIData(data); err == nil {
+			return fmt.Sprintf("%d %s", weight, quoteTXT(target))
+		}
+	}
+	return data
+}
+
+// hasPriority reports whether records of the given type have a priority.
+// Records of these types always carry it, even if it is 0, since an HTTPS
+// or SVCB record with priority 0 is in alias mode, unlike one in service
+// mode with a priority of 1 or more.
+func hasPriority(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "MX", "SRV", "URI", "HTTPS", "SVCB":
+		return true
+	}
+	return false
+}
+
+// splitPriority returns the priority and data of a record. regfish keeps
+// the priority of MX, SRV, URI, HTTPS and SVCB records in a separate field,
+// so if the record has no Priority set but carries it in front of its
+// value in zone file form (e.g. "10 mx.example.com.", "10 5 5060
+// sip.example.com." or "1 . alpn=h2"), as plain resource records do, it is
+// taken from there instead of being sent as part of the data.
+func splitPriority(record libdns.Record) (int, string) {
+	if record.Priority != 0 {
+		return record.Priority, record.Value
+	}
+
+	parts := strings.Fields(record.Value)
+	switch strings.ToUpper(record.Type) {
+	case "MX":
+		if len(parts) != 2 {
+			return record.Priority, record.Value
+		}
+	case "SRV":
+		if len(parts) != 4 {
+			return record.Priority, record.Value
+		}
+	case "URI":
+		// priority, weight and a quoted target
+		if len(parts) != 3 || !isUint(parts[1]) {
+			return record.Priority, record.Value
+		}
+	case "HTTPS", "SVCB":
+		// priority, target and optional parameters, which all have the
+		// form key=value
+		if len(parts) < 2 || strings.Contains(parts[1], "=") {
+			return record.Priority, record.Value
+		}
+	default:
+		return record.Priority, record.Value
+	}
+
+	priority, err := strconv.Atoi(parts[0])
+	if err != nil || priority < 0 {
+		return record.Priority, record.Value
+	}
+	return priority, strings.Join(parts[1:], " ")
+}
+
+// isUint reports whether s is a decimal number without a sign.
+func isUint(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// getPriority returns the priority of a record and 0 if it is nil.
+func getPriority(prio *int) int {
+	if prio != nil {
+		return *prio
+	}
+	return 0
+}
@@ -0,0 +1,217 @@
+package regfish_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToLibdnsRecord(t *testing.T) {
+	prio := 10
+	rec := regfish.ToLibdnsRecord(rfns.Record{
+		ID:       42,
+		Name:     "mail.example.com.",
+		Type:     "MX",
+		Data:     "mx.example.net.",
+		TTL:      3600,
+		Priority: &prio,
+	}, "example.com.")
+
+	assert.Equal(t, libdns.Record{
+		ID:       "42",
+		Type:     "MX",
+		Name:     "mail",
+		Value:    "mx.example.net.",
+		TTL:      time.Hour,
+		Priority: 10,
+	}, rec)
+
+	rec = regfish.ToLibdnsRecord(rfns.Record{ID: 1, Name: "example.com.", Type: "A", Data: "10.0.0.1"}, "example.com")
+	assert.Equal(t, "", rec.Name)
+	assert.Equal(t, 0, rec.Priority)
+}
+
+func TestToLibdnsRecordDeepNames(t *testing.T) {
+	for _, tc := range []struct {
+		name, zone, want string
+	}{
+		{"a.b.c.example.com.", "example.com.", "a.b.c"},
+		{"a.b.c.example.com", "example.com.", "a.b.c"},
+		{"a.b.c.example.com.", "example.com", "a.b.c"},
+		{"A.B.C.Example.COM.", "example.com.", "A.B.C"},
+		{"host.sub.example.com.", "sub.example.com.", "host"},
+		{"a.b.myexample.com.", "example.com.", "a.b.myexample.com"},
+	} {
+		rec := regfish.ToLibdnsRecord(rfns.Record{Name: tc.name, Type: "A", Data: "10.0.0.1"}, tc.zone)
+		assert.Equal(t, tc.want, rec.Name, "%s in %s", tc.name, tc.zone)
+	}
+
+	in := libdns.Record{Type: "TXT", Name: "_acme-challenge.a.b", Value: "token", TTL: time.Minute}
+	out := regfish.ToLibdnsRecord(regfish.FromLibdnsRecord(in, "example.com."), "example.com.")
+	assert.Equal(t, "_acme-challenge.a.b.example.com.", regfish.FromLibdnsRecord(in, "example.com.").Name)
+	assert.Equal(t, in.Name, out.Name)
+}
+
+func TestFromLibdnsRecord(t *testing.T) {
+	rec := regfish.FromLibdnsRecord(libdns.Record{
+		Type:     "MX",
+		Name:     "mail",
+		Value:    "mx.example.net.",
+		TTL:      time.Hour,
+		Priority: 10,
+	}, "example.com")
+
+	assert.Equal(t, "mail.example.com.", rec.Name)
+	assert.Equal(t, "MX", rec.Type)
+	assert.Equal(t, "mx.example.net.", rec.Data)
+	assert.Equal(t, 3600, rec.TTL)
+	if assert.NotNil(t, rec.Priority) {
+		assert.Equal(t, 10, *rec.Priority)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	in := libdns.Record{Type: "TXT", Name: "_acme-challenge.www", Value: "token", TTL: time.Minute}
+	out := regfish.ToLibdnsRecord(regfish.FromLibdnsRecord(in, "example.com."), "example.com.")
+	out.ID = ""
+	assert.Equal(t, in, out)
+}
+
+func TestFromLibdnsRecordPriorityInValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   libdns.Record
+		priority int
+		data     string
+	}{
+		{"MX in zone file form", libdns.Record{Type: "MX", Name: "", Value: "10 mx.example.net."}, 10, "mx.example.net."},
+		{"MX with Priority field", libdns.Record{Type: "MX", Name: "", Value: "mx.example.net.", Priority: 20}, 20, "mx.example.net."},
+		{"MX with both", libdns.Record{Type: "MX", Name: "", Value: "10 mx.example.net.", Priority: 20}, 20, "10 mx.example.net."},
+		{"MX with null priority", libdns.Record{Type: "MX", Name: "", Value: "0 ."}, 0, "."},
+		{"SRV in zone file form", libdns.Record{Type: "SRV", Name: "_sip._udp", Value: "10 5 5060 sip.example.com."}, 10, "5 5060 sip.example.com."},
+		{"SRV without priority", libdns.Record{Type: "SRV", Name: "_sip._udp", Value: "5 5060 sip.example.com."}, 0, "5 5060 sip.example.com."},
+		{"URI in zone file form", libdns.Record{Type: "URI", Name: "_http._tcp", Value: `10 1 "https://www.example.com/"`}, 10, `1 "https://www.example.com/"`},
+		{"URI without priority", libdns.Record{Type: "URI", Name: "_http._tcp", Value: `1 "https://www.example.com/"`}, 0, `1 "https://www.example.com/"`},
+		{"HTTPS service mode in zone file form", libdns.Record{Type: "HTTPS", Name: "www", Value: "1 . alpn=h2,h3"}, 1, ". alpn=h2,h3"},
+		{"HTTPS alias mode in zone file form", libdns.Record{Type: "HTTPS", Name: "", Value: "0 cdn.example.net."}, 0, "cdn.example.net."},
+		{"HTTPS without priority", libdns.Record{Type: "HTTPS", Name: "", Value: "cdn.example.net."}, 0, "cdn.example.net."},
+		{"SVCB in zone file form", libdns.Record{Type: "SVCB", Name: "_dns", Value: "2 dns.example.net. alpn=dot port=853"}, 2, "dns.example.net. alpn=dot port=853"},
+		{"SVCB with Priority field", libdns.Record{Type: "SVCB", Name: "_dns", Value: "dns.example.net. alpn=dot", Priority: 3}, 3, "dns.example.net. alpn=dot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := regfish.FromLibdnsRecord(tt.record, "example.com")
+			assert.Equal(t, tt.data, rec.Data)
+			if assert.NotNil(t, rec.Priority) {
+				assert.Equal(t, tt.priority, *rec.Priority)
+			}
+		})
+	}
+}
+
+func TestFromLibdnsRecordOverQualifiedName(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+		want string
+	}{
+		{"www", "example.com", "www.example.com."},
+		{"www.example.com", "example.com", "www.example.com."},
+		{"www.example.com.", "example.com.", "www.example.com."},
+		{"WWW.Example.COM", "example.com", "WWW.example.com."},
+		{"example.com", "example.com", "example.com."},
+		{"myexample.com", "example.com", "myexample.com.example.com."},
+		{"a.b.example.com", "example.com", "a.b.example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := regfish.FromLibdnsRecord(libdns.Record{Type: "A", Name: tt.name, Value: "192.0.2.1"}, tt.zone)
+			assert.Equal(t, tt.want, rec.Name)
+		})
+	}
+}
+
+func TestFromLibdnsRecordPriorityIgnored(t *testing.T) {
+	rec := regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Name: "", Value: "10 things", Priority: 5}, "example.com")
+	assert.Equal(t, "10 things", rec.Data)
+	assert.Nil(t, rec.Priority)
+}
+
+func TestNormalize(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "@", Type: "MX", Value: "10 mx.example.com.", TTL: 90*time.Second + 500*time.Millisecond},
+		{Name: "www.example.com", Type: "A", Value: "10.0.0.1", TTL: time.Hour, Priority: 5},
+		{Name: "_srv._tcp", Type: "SRV", Value: "5 5060 sip.example.com.", TTL: time.Hour, Priority: 10},
+		{Name: "long", Type: "TXT", Value: strings.Repeat("a", 300), TTL: time.Hour},
+	}
+
+	api := newMockAPI(t)
+	written, err := api.provider().AppendRecords(context.Background(), test_zone, records)
+	assert.Nil(t, err)
+
+	for i, record := range records {
+		normalized := regfish.Normalize(record, test_zone)
+		written[i].ID = ""
+		assert.Equal(t, written[i], normalized, "record %d", i)
+	}
+
+	assert.Equal(t, libdns.Record{Name: "", Type: "MX", Value: "mx.example.com.", TTL: 90 * time.Second, Priority: 10}, regfish.Normalize(records[0], test_zone))
+	assert.Equal(t, "www", regfish.Normalize(records[1], test_zone).Name)
+	assert.Equal(t, 0, regfish.Normalize(records[1], test_zone).Priority)
+}
+
+func TestNormalizeAddresses(t *testing.T) {
+	for _, tc := range []struct {
+		typ, value, want string
+	}{
+		{"A", "192.0.2.1", "192.0.2.1"},
+		{"A", "::ffff:192.0.2.1", "192.0.2.1"},
+		{"A", "::FFFF:C000:0201", "192.0.2.1"},
+		{"A", "not-an-address", "not-an-address"},
+		{"AAAA", "2001:DB8::1", "2001:db8::1"},
+		{"AAAA", "2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"AAAA", "2001:db8:0:0:1:0:0:1", "2001:db8::1:0:0:1"},
+		{"AAAA", "::ffff:192.0.2.1", "::ffff:192.0.2.1"},
+		{"AAAA", "192.0.2.1", "192.0.2.1"},
+	} {
+		record := regfish.Normalize(libdns.Record{Name: "www", Type: tc.typ, Value: tc.value}, test_zone)
+		assert.Equal(t, tc.want, record.Value, "%s %s", tc.typ, tc.value)
+	}
+}
+
+func TestServiceBindingModes(t *testing.T) {
+	api := newMockAPI(t)
+	records := []libdns.Record{
+		{Name: "", Type: "HTTPS", Value: "cdn.example.net.", TTL: time.Hour, Priority: 0},
+		{Name: "www", Type: "HTTPS", Value: ". alpn=h2,h3", TTL: time.Hour, Priority: 1},
+		{Name: "_dns", Type: "SVCB", Value: "dns.example.net. alpn=dot", TTL: time.Hour, Priority: 2},
+	}
+
+	_, err := api.provider().AppendRecords(context.Background(), test_zone, records)
+	assert.Nil(t, err)
+
+	stored := api.snapshot()
+	if assert.Len(t, stored, 3) {
+		if assert.NotNil(t, stored[0].Priority, "alias mode priority dropped") {
+			assert.Equal(t, 0, *stored[0].Priority)
+		}
+		if assert.NotNil(t, stored[1].Priority) {
+			assert.Equal(t, 1, *stored[1].Priority)
+		}
+	}
+
+	read, err := api.provider().GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	for i, record := range read {
+		record.ID = ""
+		assert.Equal(t, records[i], record)
+	}
+}
@@ -0,0 +1,135 @@
+package regfish
+
+import (
+	"sort"
+
+	"github.com/libdns/libdns"
+)
+
+// ChangeSet holds the changes that turn one set of records into another.
+// Apply them in the order Deletes, Updates, Creates, so that records are
+// removed before others take their place, e.g. the A records of a name
+// before a CNAME is created there.
+type ChangeSet struct {
+	Creates []libdns.Record
+	Updates []RecordUpdate
+	Deletes []libdns.Record
+}
+
+// RecordUpdate is a change of a single record.
+type RecordUpdate struct {
+	// Old is the live record.
+	Old libdns.Record
+
+	// New is the desired record, with the ID of Old.
+	New libdns.Record
+}
+
+// Empty reports whether the change set holds no changes.
+func (c ChangeSet) Empty() bool {
+	return len(c.Creates) == 0 && len(c.Updates) == 0 && len(c.Deletes) == 0
+}
+
+// DiffSnapshots compares the desired records of a zone to the live ones,
+// e.g. as returned by GetRecords, and returns the changes that make the
+// zone hold exactly the desired records. Both are given with names
+// relative to the zone.
+//
+// Records are grouped into sets by name and type, compared as by
+// RecordsEqual. Within a set, a desired record whose value is live already
+// needs no change if its TTL and priority match as well, and is an update
+// of that live record otherwise. Remaining desired records update the
+// remaining live records of the set, in order of their values; surplus
+// desired records are created and surplus live ones deleted. IDs of
+// desired records are ignored. The result is sorted by name, type and
+// value, so it is the same for the same input.
+func DiffSnapshots(desired, live []libdns.Record) ChangeSet {
+	type recordSet struct{ desired, live []libdns.Record }
+	sets := make(map[string]*recordSet)
+	var keys []string
+	set := func(record libdns.Record) *recordSet {
+		key := recordKey(normalizeName(record.Name), record.Type)
+		if _, ok := sets[key]; !ok {
+			sets[key] = &recordSet{}
+			keys = append(keys, key)
+		}
+		return sets[key]
+	}
+	for _, record := range desired {
+		s := set(record)
+		s.desired = append(s.desired, record)
+	}
+	for _, record := range live {
+		s := set(record)
+		s.live = append(s.live, record)
+	}
+	sort.Strings(keys)
+
+	var changes ChangeSet
+	for _, key := range keys {
+		s := sets[key]
+		sortByValue(s.desired)
+		sortByValue(s.live)
+
+		// Pair desired and live records of the same value.
+		used := make([]bool, len(s.live))
+		var remaining []libdns.Record
+		for _, want := range s.desired {
+			matched := false
+			for i, have := range s.live {
+				if used[i] || normalizeValue(have.Type, have.Value) != normalizeValue(want.Type, want.Value) {
+					continue
+				}
+				used[i] = true
+				matched = true
+				if have.TTL != want.TTL || have.Priority != want.Priority {
+					changes.Updates = append(changes.Updates, newRecordUpdate(have, want))
+				}
+				break
+			}
+			if !matched {
+				remaining = append(remaining, want)
+			}
+		}
+
+		// Pair the rest in order, and create or delete the surplus.
+		for i, have := range s.live {
+			if used[i] {
+				continue
+			}
+			if len(remaining) > 0 {
+				changes.Updates = append(changes.Updates, newRecordUpdate(have, remaining[0]))
+				remaining = remaining[1:]
+				continue
+			}
+			changes.Deletes = append(changes.Deletes, have)
+		}
+		for _, want := range remaining {
+			want.ID = ""
+			changes.Creates = append(changes.Creates, want)
+		}
+	}
+
+	return changes
+}
+
+// newRecordUpdate returns the update of the live record have to want.
+func newRecordUpdate(have, want libdns.Record) RecordUpdate {
+	want.ID = have.ID
+	return RecordUpdate{Old: have, New: want}
+}
+
+// sortByValue sorts records of the same name and type by their normalized
+// value, then TTL and priority.
+func sortByValue(records []libdns.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		vi, vj := normalizeValue(records[i].Type, records[i].Value), normalizeValue(records[j].Type, records[j].Value)
+		if vi != vj {
+			return vi < vj
+		}
+		if records[i].TTL != records[j].TTL {
+			return records[i].TTL < records[j].TTL
+		}
+		return records[i].Priority < records[j].Priority
+	})
+}
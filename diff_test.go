@@ -0,0 +1,146 @@
+package regfish_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshotsNoChanges(t *testing.T) {
+	live := []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{ID: "2", Name: "", Type: "MX", Value: "mx.example.com.", TTL: time.Hour, Priority: 10},
+		{ID: "3", Name: "v6", Type: "AAAA", Value: "2001:db8::1", TTL: time.Hour},
+	}
+	desired := []libdns.Record{
+		{Name: "@", Type: "mx", Value: "MX.example.com", TTL: time.Hour, Priority: 10},
+		{Name: "WWW", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{Name: "v6", Type: "AAAA", Value: "2001:0db8::0001", TTL: time.Hour},
+	}
+
+	changes := regfish.DiffSnapshots(desired, live)
+	assert.True(t, changes.Empty(), "%+v", changes)
+}
+
+func TestDiffSnapshotsTTLOnly(t *testing.T) {
+	live := []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{ID: "2", Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+	}
+	desired := []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Minute},
+	}
+
+	assert.Equal(t, regfish.ChangeSet{
+		Updates: []regfish.RecordUpdate{{
+			Old: live[0],
+			New: libdns.Record{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Minute},
+		}},
+	}, regfish.DiffSnapshots(desired, live))
+}
+
+func TestDiffSnapshotsPriorityOnly(t *testing.T) {
+	live := []libdns.Record{{ID: "1", Name: "", Type: "MX", Value: "mx.example.com.", TTL: time.Hour, Priority: 10}}
+	desired := []libdns.Record{{Name: "", Type: "MX", Value: "mx.example.com.", TTL: time.Hour, Priority: 20}}
+
+	changes := regfish.DiffSnapshots(desired, live)
+	if assert.Len(t, changes.Updates, 1) {
+		assert.Equal(t, 20, changes.Updates[0].New.Priority)
+		assert.Equal(t, "1", changes.Updates[0].New.ID)
+	}
+	assert.Empty(t, changes.Creates)
+	assert.Empty(t, changes.Deletes)
+}
+
+func TestDiffSnapshotsMultiValue(t *testing.T) {
+	live := []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{ID: "2", Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		{ID: "3", Name: "www", Type: "A", Value: "10.0.0.3", TTL: time.Hour},
+	}
+
+	t.Run("Replace one value", func(t *testing.T) {
+		desired := []libdns.Record{
+			{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+			{Name: "www", Type: "A", Value: "10.0.0.3", TTL: time.Hour},
+			{Name: "www", Type: "A", Value: "10.0.0.4", TTL: time.Hour},
+		}
+		assert.Equal(t, regfish.ChangeSet{
+			Updates: []regfish.RecordUpdate{{
+				Old: live[1],
+				New: libdns.Record{ID: "2", Name: "www", Type: "A", Value: "10.0.0.4", TTL: time.Hour},
+			}},
+		}, regfish.DiffSnapshots(desired, live))
+	})
+
+	t.Run("Shrink", func(t *testing.T) {
+		desired := []libdns.Record{
+			{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		}
+		assert.Equal(t, regfish.ChangeSet{
+			Deletes: []libdns.Record{live[0], live[2]},
+		}, regfish.DiffSnapshots(desired, live))
+	})
+
+	t.Run("Grow", func(t *testing.T) {
+		desired := append(append([]libdns.Record(nil), live...),
+			libdns.Record{ID: "99", Name: "www", Type: "A", Value: "10.0.0.5", TTL: time.Hour},
+			libdns.Record{Name: "www", Type: "A", Value: "10.0.0.4", TTL: time.Hour},
+		)
+		assert.Equal(t, regfish.ChangeSet{
+			Creates: []libdns.Record{
+				{Name: "www", Type: "A", Value: "10.0.0.4", TTL: time.Hour},
+				{Name: "www", Type: "A", Value: "10.0.0.5", TTL: time.Hour},
+			},
+		}, regfish.DiffSnapshots(desired, live))
+	})
+}
+
+func TestDiffSnapshotsCNAMEConflict(t *testing.T) {
+	live := []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{ID: "2", Name: "www", Type: "AAAA", Value: "2001:db8::1", TTL: time.Hour},
+		{ID: "3", Name: "ftp", Type: "CNAME", Value: "www.example.com.", TTL: time.Hour},
+	}
+	desired := []libdns.Record{
+		{Name: "www", Type: "CNAME", Value: "cdn.example.net.", TTL: time.Hour},
+		{Name: "ftp", Type: "CNAME", Value: "files.example.net.", TTL: time.Hour},
+	}
+
+	assert.Equal(t, regfish.ChangeSet{
+		Creates: []libdns.Record{desired[0]},
+		Updates: []regfish.RecordUpdate{{
+			Old: live[2],
+			New: libdns.Record{ID: "3", Name: "ftp", Type: "CNAME", Value: "files.example.net.", TTL: time.Hour},
+		}},
+		Deletes: []libdns.Record{live[0], live[1]},
+	}, regfish.DiffSnapshots(desired, live))
+}
+
+func TestDiffSnapshotsDeterministic(t *testing.T) {
+	live := []libdns.Record{
+		{ID: "1", Name: "b", Type: "A", Value: "10.0.0.1"},
+		{ID: "2", Name: "a", Type: "TXT", Value: "x"},
+		{ID: "3", Name: "a", Type: "A", Value: "10.0.0.9"},
+	}
+	desired := []libdns.Record{
+		{Name: "c", Type: "A", Value: "10.0.0.3"},
+		{Name: "a", Type: "A", Value: "10.0.0.2"},
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+	}
+
+	first := regfish.DiffSnapshots(desired, live)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, regfish.DiffSnapshots(desired, live))
+	}
+	assert.Equal(t, []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.2"},
+		{Name: "c", Type: "A", Value: "10.0.0.3"},
+	}, first.Creates)
+	assert.Equal(t, "3", first.Updates[0].New.ID)
+	assert.Equal(t, []libdns.Record{live[1], live[0]}, first.Deletes)
+}
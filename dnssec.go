@@ -0,0 +1,260 @@
+package regfish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// DNSSECStatus is the DNSSEC state of a zone as published by regfish.
+type DNSSECStatus struct {
+	// Enabled reports whether the zone publishes DNSKEY records.
+	Enabled bool
+
+	// DNSKEYs are the DNSKEY records of the zone apex.
+	DNSKEYs []libdns.Record
+
+	// DS are the DS record values to submit to the parent zone, e.g.
+	// "2371 13 2 3299...", taken from the CDS records of the zone if it
+	// has any and computed with SHA-256 from its key signing keys
+	// otherwise.
+	DS []string
+}
+
+// GetDNSSECStatus reports whether DNSSEC is enabled for the zone and which
+// DS records the parent zone needs, e.g. to submit them to a registrar.
+// The regfish API has no DNSSEC endpoint, so the status is derived from
+// the DNSKEY and CDS records published at the zone apex.
+func (p *Provider) GetDNSSECStatus(ctx context.Context, zone string) (DNSSECStatus, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return DNSSECStatus{}, err
+	}
+
+	// The DS digest covers the zone name as published, in punycode.
+	apiZone, err := p.toAPIName(zone)
+	if err != nil {
+		return DNSSECStatus{}, err
+	}
+
+	var status DNSSECStatus
+	var cds []string
+	for _, record := range records {
+		if normalizeName(record.Name) != "" {
+			continue
+		}
+		switch strings.ToUpper(record.Type) {
+		case "DNSKEY":
+			status.DNSKEYs = append(status.DNSKEYs, record)
+		case "CDS":
+			cds = append(cds, normalizeValue(record.Type, record.Value))
+		}
+	}
+	status.Enabled = len(status.DNSKEYs) > 0
+
+	if len(cds) > 0 {
+		status.DS = cds
+		return status, nil
+	}
+	for _, key := range status.DNSKEYs {
+		dnskey, err := ParseDNSKEY(key.Value)
+		if err != nil {
+			return DNSSECStatus{}, err
+		}
+		if !dnskey.SecureEntryPoint() {
+			continue
+		}
+		status.DS = append(status.DS, dnskey.DS(apiZone))
+	}
+	return status, nil
+}
+
+// DNSKEY is the parsed value of a DNSKEY record.
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+// ParseDNSKEY parses the value of a DNSKEY, CDNSKEY or similar record,
+// such as "257 3 13 mdsswUyr3DPW...".
+func ParseDNSKEY(value string) (DNSKEY, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return DNSKEY{}, fmt.Errorf("malformed DNSKEY value %q; expected: '<flags> <protocol> <algorithm> <public key>'", value)
+	}
+
+	flags, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return DNSKEY{}, fmt.Errorf("invalid DNSKEY flags %s: %v", fields[0], err)
+	}
+	protocol, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return DNSKEY{}, fmt.Errorf("invalid DNSKEY protocol %s: %v", fields[1], err)
+	}
+	algorithm, err := strconv.ParseUint(fields[2], 10, 8)
+	if err != nil {
+		return DNSKEY{}, fmt.Errorf("invalid DNSKEY algorithm %s: %v", fields[2], err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return DNSKEY{}, fmt.Errorf("invalid DNSKEY public key: %v", err)
+	}
+
+	return DNSKEY{
+		Flags:     uint16(flags),
+		Protocol:  uint8(protocol),
+		Algorithm: uint8(algorithm),
+		PublicKey: key,
+	}, nil
+}
+
+// String returns the value of the DNSKEY record, with the public key in
+// base64 as a single field.
+func (k DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", k.Flags, k.Protocol, k.Algorithm, base64.StdEncoding.EncodeToString(k.PublicKey))
+}
+
+// validate checks that k uses protocol 3, as all DNSKEY records must, and
+// has a public key. A CDNSKEY record of algorithm 0 requests the removal
+// of the DS records and carries a single zero byte as key.
+func (k DNSKEY) validate() error {
+	if k.Protocol != 3 {
+		return fmt.Errorf("DNSKEY protocol is %d instead of 3", k.Protocol)
+	}
+	if len(k.PublicKey) == 0 {
+		return fmt.Errorf("DNSKEY public key is empty")
+	}
+	return nil
+}
+
+// SecureEntryPoint reports whether the SEP flag is set, which marks a key
+// signing key.
+func (k DNSKEY) SecureEntryPoint() bool {
+	return k.Flags&1 != 0
+}
+
+// rdata returns the key in wire format.
+func (k DNSKEY) rdata() []byte {
+	rdata := make([]byte, 4, 4+len(k.PublicKey))
+	binary.BigEndian.PutUint16(rdata, k.Flags)
+	rdata[2] = k.Protocol
+	rdata[3] = k.Algorithm
+	return append(rdata, k.PublicKey...)
+}
+
+// KeyTag returns the key tag of the key, as defined in RFC 4034,
+// Appendix B.
+func (k DNSKEY) KeyTag() uint16 {
+	var ac uint32
+	for i, b := range k.rdata() {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac & 0xffff)
+}
+
+// DS returns the value of the DS record for the key at the apex of zone,
+// with a SHA-256 digest (digest type 2).
+func (k DNSKEY) DS(zone string) string {
+	h := sha256.New()
+	h.Write(wireName(zone))
+	h.Write(k.rdata())
+	return fmt.Sprintf("%d %d 2 %s", k.KeyTag(), k.Algorithm, strings.ToUpper(hex.EncodeToString(h.Sum(nil))))
+}
+
+// wireName returns the canonical wire format of a domain name: lowercase
+// labels, each prefixed with its length, ending with the root label.
+func wireName(name string) []byte {
+	var wire []byte
+	name = strings.ToLower(strings.Trim(name, "."))
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			wire = append(wire, byte(len(label)))
+			wire = append(wire, label...)
+		}
+	}
+	return append(wire, 0)
+}
+
+// DS is the parsed value of a DS or CDS record, which delegates trust to
+// the DNSKEY of a child zone.
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// dsDigestSizes are the digest lengths of the DS digest types in use:
+// SHA-1, SHA-256 and SHA-384.
+var dsDigestSizes = map[uint8]int{1: 20, 2: 32, 4: 48}
+
+// ParseDS parses the value of a DS or CDS record, such as
+// "2371 13 2 1F987CC6...". The digest may be split by spaces and in either
+// case.
+func ParseDS(value string) (DS, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return DS{}, fmt.Errorf("malformed DS value %q; expected: '<key tag> <algorithm> <digest type> <digest>'", value)
+	}
+
+	keyTag, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return DS{}, fmt.Errorf("invalid DS key tag %s: %v", fields[0], err)
+	}
+	algorithm, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return DS{}, fmt.Errorf("invalid DS algorithm %s: %v", fields[1], err)
+	}
+	digestType, err := strconv.ParseUint(fields[2], 10, 8)
+	if err != nil {
+		return DS{}, fmt.Errorf("invalid DS digest type %s: %v", fields[2], err)
+	}
+	digest, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return DS{}, fmt.Errorf("invalid DS digest: %v", err)
+	}
+
+	return DS{
+		KeyTag:     uint16(keyTag),
+		Algorithm:  uint8(algorithm),
+		DigestType: uint8(digestType),
+		Digest:     digest,
+	}, nil
+}
+
+// String returns the value of the DS record, with the digest in uppercase
+// hex as DNSKEY.DS returns it.
+func (d DS) String() string {
+	return fmt.Sprintf("%d %d %d %s", d.KeyTag, d.Algorithm, d.DigestType, strings.ToUpper(hex.EncodeToString(d.Digest)))
+}
+
+// validate checks that the digest of d has the length of its digest type.
+// A CDS record of algorithm 0 requests the removal of the DS records and
+// carries a single zero byte as digest.
+func (d DS) validate() error {
+	if d.Algorithm == 0 && d.DigestType == 0 {
+		return nil
+	}
+	size, ok := dsDigestSizes[d.DigestType]
+	if !ok {
+		return fmt.Errorf("unknown DS digest type %d", d.DigestType)
+	}
+	if len(d.Digest) != size {
+		return fmt.Errorf("DS digest of type %d has %d bytes instead of %d", d.DigestType, len(d.Digest), size)
+	}
+	return nil
+}
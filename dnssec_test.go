@@ -0,0 +1,165 @@
+package regfish_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// cloudflareKSK is the key signing key of cloudflare.com, whose DS record
+// is published in the com zone.
+const (
+	cloudflareKSK = "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="
+	cloudflareDS  = "2371 13 2 32996839A6D808AFE3EB4A795A0E6A7A39A76FC52FF228B22B76F6D63826F2B9"
+)
+
+func TestDNSKEYDS(t *testing.T) {
+	key, err := regfish.ParseDNSKEY(cloudflareKSK)
+	assert.Nil(t, err)
+	assert.True(t, key.SecureEntryPoint())
+	assert.Equal(t, uint16(2371), key.KeyTag())
+	assert.Equal(t, cloudflareDS, key.DS("cloudflare.com."))
+}
+
+func TestGetDNSSECStatus(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "cloudflare.com.", Type: "DNSKEY", Data: cloudflareKSK, TTL: 3600},
+		rfns.Record{Name: "cloudflare.com.", Type: "DNSKEY", Data: "256 3 13 oJMRESz5E4gYzS/q6XDrvU1qMPYIjCWzJaOau8XNEZeqCYKD5ar0IRd8KqXXFJkqmVfRvMGPmM1x8fGAa2XhSA==", TTL: 3600},
+		rfns.Record{Name: "www.cloudflare.com.", Type: "A", Data: "104.16.124.96", TTL: 300},
+	)
+
+	status, err := api.provider().GetDNSSECStatus(context.Background(), "cloudflare.com.")
+	assert.Nil(t, err)
+	assert.True(t, status.Enabled)
+	assert.Len(t, status.DNSKEYs, 2)
+	assert.Equal(t, []string{cloudflareDS}, status.DS)
+}
+
+func TestGetDNSSECStatusIDN(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "xn--bcher-kva.example.", Type: "DNSKEY", Data: cloudflareKSK, TTL: 3600},
+	)
+	p := api.provider()
+	p.IDN = true
+
+	status, err := p.GetDNSSECStatus(context.Background(), "bücher.example.")
+	assert.Nil(t, err)
+	key, err := regfish.ParseDNSKEY(cloudflareKSK)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{key.DS("xn--bcher-kva.example.")}, status.DS)
+}
+
+func TestGetDNSSECStatusCDS(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "DNSKEY", Data: cloudflareKSK, TTL: 3600},
+		rfns.Record{Name: "example.com.", Type: "CDS", Data: "12345  13 2 ABCDEF", TTL: 3600},
+	)
+
+	p := api.provider()
+	for _, apexAt := range []bool{false, true} {
+		p.ApexAt = apexAt
+		status, err := p.GetDNSSECStatus(context.Background(), test_zone)
+		assert.Nil(t, err)
+		assert.True(t, status.Enabled)
+		assert.Equal(t, []string{"12345 13 2 ABCDEF"}, status.DS)
+	}
+}
+
+func TestGetDNSSECStatusDisabled(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	status, err := api.provider().GetDNSSECStatus(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.False(t, status.Enabled)
+	assert.Empty(t, status.DS)
+}
+
+func TestParseDS(t *testing.T) {
+	ds, err := regfish.ParseDS("2371 13 2 " + strings.ToLower(cloudflareDS[10:40]) + " " + cloudflareDS[40:])
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(2371), ds.KeyTag)
+	assert.Equal(t, uint8(13), ds.Algorithm)
+	assert.Equal(t, uint8(2), ds.DigestType)
+	assert.Len(t, ds.Digest, 32)
+	assert.Equal(t, cloudflareDS, ds.String())
+
+	for _, value := range []string{"2371 13 2", "70000 13 2 AB", "2371 13 2 XY"} {
+		_, err := regfish.ParseDS(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestValidateDS(t *testing.T) {
+	for _, tt := range []struct {
+		record libdns.Record
+		err    string
+	}{
+		{libdns.Record{Type: "DS", Name: "sub", Value: cloudflareDS}, ""},
+		{libdns.Record{Type: "CDS", Name: "", Value: cloudflareDS}, ""},
+		{libdns.Record{Type: "CDS", Name: "", Value: "0 0 0 00"}, ""},
+		{libdns.Record{Type: "DS", Name: "@", Value: cloudflareDS}, "parent zone"},
+		{libdns.Record{Type: "DS", Name: "sub", Value: "2371 13 1 " + cloudflareDS[10:]}, "instead of 20"},
+		{libdns.Record{Type: "DS", Name: "sub", Value: "2371 13 3 " + cloudflareDS[10:]}, "unknown DS digest type"},
+	} {
+		err := regfish.ValidateRecord(tt.record)
+		if tt.err == "" {
+			assert.Nil(t, err, tt.record.Value)
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.record.Value)
+		}
+	}
+}
+
+func TestAppendDSCanonical(t *testing.T) {
+	api := newMockAPI(t)
+	records, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "sub", Type: "DS", Value: strings.ToLower(cloudflareDS), TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, cloudflareDS, records[0].Value)
+	}
+}
+
+func TestDNSKEYCanonical(t *testing.T) {
+	key, err := regfish.ParseDNSKEY(cloudflareKSK[:40] + " " + cloudflareKSK[40:])
+	assert.Nil(t, err)
+	assert.Equal(t, cloudflareKSK, key.String())
+
+	for _, tt := range []struct {
+		record libdns.Record
+		err    string
+	}{
+		{libdns.Record{Type: "DNSKEY", Name: "", Value: cloudflareKSK}, ""},
+		{libdns.Record{Type: "CDNSKEY", Name: "", Value: "0 3 0 AA=="}, ""},
+		{libdns.Record{Type: "DNSKEY", Name: "", Value: "257 2 13 " + cloudflareKSK[9:]}, "protocol is 2"},
+		{libdns.Record{Type: "CDNSKEY", Name: "", Value: "257 3 13 not-base64"}, "invalid DNSKEY public key"},
+	} {
+		err := regfish.ValidateRecord(tt.record)
+		if tt.err == "" {
+			assert.Nil(t, err, tt.record.Value)
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.record.Value)
+		}
+	}
+
+	// A key given split over several fields matches the one regfish holds.
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "DNSKEY", Data: cloudflareKSK, TTL: 3600},
+	)
+	p := api.provider()
+	p.SkipUnchanged = true
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "", Type: "DNSKEY", Value: cloudflareKSK[:40] + " " + cloudflareKSK[40:], TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 1)
+}
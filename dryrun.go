@@ -0,0 +1,21 @@
+package regfish
+
+import "context"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context that enables or disables dry-run mode for
+// calls made with it, overriding Provider.DryRun. This lets a single
+// Provider serve both previews and real changes.
+func WithDryRun(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, enabled)
+}
+
+// dryRun reports whether changes are to be skipped for a call made with
+// ctx. A setting in ctx takes precedence over Provider.DryRun.
+func (p *Provider) dryRun(ctx context.Context) bool {
+	if enabled, ok := ctx.Value(dryRunKey{}).(bool); ok {
+		return enabled
+	}
+	return p.DryRun
+}
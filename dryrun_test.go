@@ -0,0 +1,65 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	dry := regfish.WithDryRun(context.Background(), true)
+
+	t.Run("AppendRecords", func(t *testing.T) {
+		result, err := p.AppendRecords(dry, test_zone, []libdns.Record{{Name: "new", Type: "A", Value: "10.0.0.2"}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "new", result[0].Name)
+			assert.Equal(t, "", result[0].ID)
+		}
+	})
+
+	t.Run("SetRecords", func(t *testing.T) {
+		result, err := p.SetRecords(dry, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.3"}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "1", result[0].ID)
+			assert.Equal(t, "10.0.0.3", result[0].Value)
+		}
+	})
+
+	t.Run("DeleteRecords", func(t *testing.T) {
+		result, err := p.DeleteRecords(dry, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.1"}})
+		assert.Nil(t, err)
+		assert.Len(t, result, 1)
+	})
+
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1"))
+	assert.Equal(t, 0, api.count("DELETE /dns/rr/1"))
+	if stored := api.snapshot(); assert.Len(t, stored, 1) {
+		assert.Equal(t, "10.0.0.1", stored[0].Data)
+	}
+}
+
+func TestDryRunPrecedence(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.DryRun = true
+	record := []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.1"}}
+
+	_, err := p.AppendRecords(context.Background(), test_zone, record)
+	assert.Nil(t, err)
+	assert.Empty(t, api.snapshot())
+
+	_, err = p.AppendRecords(regfish.WithDryRun(context.Background(), false), test_zone, record)
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 1)
+}
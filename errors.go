@@ -0,0 +1,167 @@
+package regfish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBody limits how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// ErrMissingToken is returned by the methods of a Provider without an
+// APIToken, instead of the authentication failure the regfish API would
+// respond with.
+var ErrMissingToken = errors.New("regfish: APIToken is empty")
+
+// ErrInvalidToken is returned by the methods of a Provider whose APIToken
+// cannot be a regfish API key, because it contains whitespace, such as a
+// newline left over from a file, or other characters that are not
+// printable ASCII.
+var ErrInvalidToken = errors.New("regfish: APIToken is malformed")
+
+// ErrUnauthorized matches, with errors.Is, errors caused by the regfish API
+// rejecting the APIToken, i.e. responses with status 401.
+var ErrUnauthorized = errors.New("regfish API rejected the API token")
+
+// ErrServiceUnavailable matches, with errors.Is, errors caused by the
+// regfish API being down for maintenance. The Provider retries such
+// requests as RequestAttempts says, waiting as APIError.RetryAfter says,
+// up to 30 seconds, within the deadline of the context. Maintenance tends
+// to outlast those retries, so callers getting this error should back off
+// for longer before trying again.
+var ErrServiceUnavailable = errors.New("regfish API unavailable due to maintenance")
+
+// APIError is an error response of the regfish API. Errors returned by the
+// Provider wrap it, so callers can branch on it with errors.As.
+type APIError struct {
+	// HTTPStatus is the HTTP status code of the response.
+	HTTPStatus int
+
+	// Code is the machine-readable error code regfish returned, such as
+	// "invalid_record", if any.
+	Code string
+
+	// Message is the human-readable error message regfish returned, if
+	// any.
+	Message string
+
+	// Maintenance reports whether the response was a 503 indicating that
+	// the regfish API is down for maintenance.
+	Maintenance bool
+
+	// RetryAfter is how long to wait before retrying, as given by the
+	// Retry-After header of the response, or zero if it had none.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("request failed with status code %d", e.HTTPStatus)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Maintenance && e.Message == "" {
+		msg += ": " + ErrServiceUnavailable.Error()
+	}
+	return msg
+}
+
+// Is reports whether the error matches target, so that maintenance errors
+// match ErrServiceUnavailable and authentication failures ErrUnauthorized.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrServiceUnavailable:
+		return e.Maintenance
+	case ErrUnauthorized:
+		return e.HTTPStatus == http.StatusUnauthorized
+	}
+	return false
+}
+
+// newAPIError reads the error response resp, received at now, and closes
+// its body.
+func newAPIError(resp *http.Response, now time.Time) *APIError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	apiErr := parseAPIError(resp.StatusCode, body)
+	apiErr.RetryAfter = retryAfter(resp.Header.Get("Retry-After"), now)
+	apiErr.Maintenance = resp.StatusCode == http.StatusServiceUnavailable &&
+		(strings.Contains(strings.ToLower(apiErr.Code), "maintenance") || strings.Contains(strings.ToLower(string(body)), "maintenance"))
+	return apiErr
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date relative to now. It returns zero if the header is empty or
+// invalid.
+func retryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseAPIError extracts the error code and message from the body of an
+// error response. The regfish API documents no error format, so the common
+// shapes {"code": ..., "message": ...} and {"error": {"code": ...,
+// "message": ...}} are understood, with "error" also accepted as a plain
+// message. Anything else is kept as the message, trimmed.
+func parseAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{HTTPStatus: status}
+
+	type fields struct {
+		Code    interface{} `json:"code"`
+		Message string      `json:"message"`
+		Error   interface{} `json:"error"`
+	}
+	var resp fields
+	if err := json.Unmarshal(body, &resp); err != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	apiErr.Code = errorCode(resp.Code)
+	apiErr.Message = resp.Message
+	switch e := resp.Error.(type) {
+	case string:
+		if apiErr.Message == "" {
+			apiErr.Message = e
+		}
+	case map[string]interface{}:
+		if apiErr.Code == "" {
+			apiErr.Code = errorCode(e["code"])
+		}
+		if msg, ok := e["message"].(string); ok && apiErr.Message == "" {
+			apiErr.Message = msg
+		}
+	}
+	return apiErr
+}
+
+// errorCode formats an error code that may be a JSON string or number.
+func errorCode(code interface{}) string {
+	switch c := code.(type) {
+	case string:
+		return c
+	case float64:
+		return strconv.FormatFloat(c, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package regfish_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodPost {
+			return http.StatusUnprocessableEntity, `{"success": false, "code": "invalid_record", "message": "Record data is invalid"}`
+		}
+		return 0, ""
+	}
+
+	_, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "not-an-ip", TTL: time.Hour},
+	})
+
+	var apiErr *regfish.APIError
+	if assert.True(t, errors.As(err, &apiErr), "error %v is no APIError", err) {
+		assert.Equal(t, &regfish.APIError{
+			HTTPStatus: http.StatusUnprocessableEntity,
+			Code:       "invalid_record",
+			Message:    "Record data is invalid",
+		}, apiErr)
+	}
+	assert.Contains(t, err.Error(), "request failed with status code 422 (invalid_record): Record data is invalid")
+}
+
+func TestAPIErrorFormats(t *testing.T) {
+	tests := []struct {
+		body string
+		want regfish.APIError
+	}{
+		{`{"error": {"code": 42, "message": "quota exceeded"}}`, regfish.APIError{HTTPStatus: 500, Code: "42", Message: "quota exceeded"}},
+		{`{"error": "zone not found"}`, regfish.APIError{HTTPStatus: 500, Message: "zone not found"}},
+		{"Internal Server Error\n", regfish.APIError{HTTPStatus: 500, Message: "Internal Server Error"}},
+		{"", regfish.APIError{HTTPStatus: 500}},
+	}
+
+	for _, tt := range tests {
+		api := newMockAPI(t)
+		body := tt.body
+		api.fail = func(r *http.Request) (int, string) {
+			return http.StatusInternalServerError, body
+		}
+		p := api.provider()
+		p.Clock = newFakeClock()
+
+		_, err := p.GetRecords(context.Background(), test_zone)
+		var apiErr *regfish.APIError
+		if assert.True(t, errors.As(err, &apiErr), "body %q", tt.body) {
+			assert.Equal(t, tt.want, *apiErr, "body %q", tt.body)
+		}
+	}
+}
+
+func TestAPIErrorMaintenance(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusServiceUnavailable, `{"code": "maintenance", "message": "Scheduled maintenance until 04:00 UTC"}`
+	}
+	api.failHeader = http.Header{"Retry-After": {"1800"}}
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.ErrorIs(t, err, regfish.ErrServiceUnavailable)
+	// Maintenance is retried, waiting as Retry-After says, up to the cap.
+	assert.Equal(t, 3, api.count("GET /dns/example.com/rr"))
+	assert.Equal(t, []time.Duration{30 * time.Second, 30 * time.Second}, clock.slept)
+
+	var apiErr *regfish.APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.True(t, apiErr.Maintenance)
+		assert.Equal(t, "Scheduled maintenance until 04:00 UTC", apiErr.Message)
+		assert.Equal(t, 30*time.Minute, apiErr.RetryAfter)
+	}
+}
+
+func TestAPIErrorUnavailableWithoutMaintenance(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusServiceUnavailable, `{"message": "upstream timeout"}`
+	}
+	p := api.provider()
+	p.Clock = newFakeClock()
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, regfish.ErrServiceUnavailable))
+}
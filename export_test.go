@@ -0,0 +1,4 @@
+package regfish
+
+// RetryDelay exposes retryDelay to the tests.
+var RetryDelay = (*Provider).retryDelay
@@ -0,0 +1,63 @@
+package regfish
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GenericType returns the number of a record type given in the generic
+// form of RFC 3597, such as 65534 for "TYPE65534", and reports whether the
+// type has that form.
+func GenericType(recordType string) (uint16, bool) {
+	if len(recordType) <= 4 || !strings.EqualFold(recordType[:4], "TYPE") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(recordType[4:], 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(n), true
+}
+
+// isGenericData reports whether value is record data in the generic form
+// of RFC 3597, starting with `\#`.
+func isGenericData(value string) bool {
+	fields := strings.Fields(value)
+	return len(fields) > 0 && fields[0] == `\#`
+}
+
+// ParseGenericData parses record data in the generic form of RFC 3597,
+// such as `\# 4 0A000001`, the data of an A record of 10.0.0.1: the
+// length of the data in bytes and the data in hex, which may be split by
+// spaces and in either case.
+func ParseGenericData(value string) ([]byte, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, fmt.Errorf("malformed generic data %q; expected: '\\# <length> <hex data>'", value)
+	}
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic data length %s: %v", fields[1], err)
+	}
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic data: %v", err)
+	}
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("generic data has %d bytes instead of %d", len(data), length)
+	}
+	return data, nil
+}
+
+// FormatGenericData returns data in the generic form of RFC 3597, such as
+// `\# 4 0A000001`, with the data in uppercase hex. It lets records of types
+// neither the Provider nor regfish know be written as the value of a
+// record of type "TYPE<n>".
+func FormatGenericData(data []byte) string {
+	if len(data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(data), strings.ToUpper(hex.EncodeToString(data)))
+}
@@ -0,0 +1,74 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericData(t *testing.T) {
+	n, ok := regfish.GenericType("TYPE65534")
+	assert.True(t, ok)
+	assert.Equal(t, uint16(65534), n)
+	for _, recordType := range []string{"TXT", "TYPE", "TYPE70000", "TYPEX"} {
+		_, ok := regfish.GenericType(recordType)
+		assert.False(t, ok, recordType)
+	}
+
+	data, err := regfish.ParseGenericData(`\# 4 0a 00 00 01`)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{10, 0, 0, 1}, data)
+	assert.Equal(t, `\# 4 0A000001`, regfish.FormatGenericData(data))
+	assert.Equal(t, `\# 0`, regfish.FormatGenericData(nil))
+
+	data, err = regfish.ParseGenericData(`\# 0`)
+	assert.Nil(t, err)
+	assert.Empty(t, data)
+
+	for _, value := range []string{`\#`, `\# 3 0A000001`, `\# x 0A`, `\# 1 XY`, `# 1 0A`} {
+		_, err := regfish.ParseGenericData(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestValidateGeneric(t *testing.T) {
+	for _, tt := range []struct {
+		record libdns.Record
+		err    string
+	}{
+		{libdns.Record{Type: "TYPE65534", Name: "", Value: `\# 5 0D3EE70001`}, ""},
+		{libdns.Record{Type: "A", Name: "www", Value: `\# 4 0A000001`}, ""},
+		{libdns.Record{Type: "TYPE65534", Name: "", Value: "0D3EE70001"}, "generic form"},
+		{libdns.Record{Type: "TYPE65534", Name: "", Value: `\# 4 0D3EE70001`}, "instead of 4"},
+	} {
+		err := regfish.ValidateRecord(tt.record)
+		if tt.err == "" {
+			assert.Nil(t, err, tt.record.Value)
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.record.Value)
+		}
+	}
+}
+
+func TestSetRecordsGeneric(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "TYPE65534", Data: `\# 5 0d3ee70001`, TTL: 0},
+		rfns.Record{Name: "example.com.", Type: "TYPE65534", Data: `\# 5 0d3ee70002`, TTL: 0},
+	)
+	p := api.provider()
+
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "", Type: "TYPE65534", Value: `\# 5 0D3EE7 0002`, TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1002", result[0].ID)
+		assert.Equal(t, `\# 5 0D3EE70002`, result[0].Value)
+	}
+	assert.Len(t, api.snapshot(), 2)
+}
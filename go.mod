@@ -8,10 +8,12 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/regfish/regfish-dnsapi-go v0.1.1
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/net v0.35.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,57 @@
+package regfish
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HINFO is the parsed value of a HINFO record, which describes the
+// hardware and operating system of a host.
+type HINFO struct {
+	CPU string
+	OS  string
+}
+
+// ParseHINFO parses the value of a HINFO record, two character-strings
+// that are quoted if they contain spaces, such as `"Intel x86" Linux`.
+func ParseHINFO(value string) (HINFO, error) {
+	strs, err := splitCharacterStrings(value)
+	if err != nil {
+		return HINFO{}, fmt.Errorf("malformed HINFO value: %v", err)
+	}
+	if len(strs) != 2 {
+		return HINFO{}, fmt.Errorf("malformed HINFO value %q; expected: '<cpu> <os>'", value)
+	}
+	return HINFO{CPU: strs[0], OS: strs[1]}, nil
+}
+
+// String returns the value of the HINFO record, with both
+// character-strings quoted.
+func (h HINFO) String() string {
+	return quoteCharacterString(h.CPU) + " " + quoteCharacterString(h.OS)
+}
+
+// RP is the parsed value of an RP record, which names the person
+// responsible for a domain.
+type RP struct {
+	// Mbox is the mailbox of the person as a domain name, with the "@"
+	// replaced by a dot, or "." if there is none.
+	Mbox string
+
+	// Txt is the name of TXT records with further information, or "." if
+	// there are none.
+	Txt string
+}
+
+// ParseRP parses the value of an RP record, such as
+// "hostmaster.example.com. info.example.com.".
+func ParseRP(value string) (RP, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return RP{}, fmt.Errorf("malformed RP value %q; expected: '<mbox> <txt domain>'", value)
+	}
+	if strings.Contains(fields[0], "@") {
+		return RP{}, fmt.Errorf("RP mailbox %s contains an @; write it as a domain name, with a dot instead", fields[0])
+	}
+	return RP{Mbox: fields[0], Txt: fields[1]}, nil
+}
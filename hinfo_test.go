@@ -0,0 +1,57 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHINFO(t *testing.T) {
+	h, err := regfish.ParseHINFO(`"Intel x86" Linux`)
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.HINFO{CPU: "Intel x86", OS: "Linux"}, h)
+	assert.Equal(t, `"Intel x86" "Linux"`, h.String())
+
+	h, err = regfish.ParseHINFO(`"say \"hi\"" "C:\\"`)
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.HINFO{CPU: `say "hi"`, OS: `C:\`}, h)
+	assert.Equal(t, `"say \"hi\"" "C:\\"`, h.String())
+
+	for _, value := range []string{`Linux`, `"Intel x86 Linux`, `a b c`} {
+		_, err := regfish.ParseHINFO(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestParseRP(t *testing.T) {
+	rp, err := regfish.ParseRP("hostmaster.example.com. info.example.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.RP{Mbox: "hostmaster.example.com.", Txt: "info.example.com."}, rp)
+
+	_, err = regfish.ParseRP("hostmaster@example.com. .")
+	assert.ErrorContains(t, err, "contains an @")
+	assert.NotNil(t, regfish.ValidateRecord(libdns.Record{Type: "RP", Name: "www", Value: "hostmaster.example.com."}))
+}
+
+func TestSetRecordsHINFO(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "host.example.com.", Type: "HINFO", Data: `"Intel x86" "Linux"`, TTL: 300},
+		rfns.Record{Name: "host.example.com.", Type: "RP", Data: "hostmaster.example.com. .", TTL: 300},
+	)
+	p := api.provider()
+	p.SkipUnchanged = true
+
+	// Records given in another quoting or case are found unchanged.
+	_, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "host", Type: "HINFO", Value: `"Intel x86" Linux`, TTL: 5 * time.Minute},
+		{Name: "host", Type: "RP", Value: "Hostmaster.example.com. .", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 2)
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+}
@@ -0,0 +1,81 @@
+package regfish
+
+import (
+	"fmt"
+
+	"github.com/libdns/libdns"
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts between Unicode and punycode names. It does not
+// restrict names to host name characters, so that names such as
+// "_acme-challenge" pass through unchanged.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// toAPIName converts name to the form the regfish API expects, which is
+// punycode if IDN is enabled.
+func (p *Provider) toAPIName(name string) (string, error) {
+	if !p.IDN || name == "" {
+		return name, nil
+	}
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized name %s: %w", name, err)
+	}
+	return ascii, nil
+}
+
+// fromAPIName converts a name returned by the regfish API to Unicode if
+// IDN is enabled. Names that cannot be converted are returned as is.
+func (p *Provider) fromAPIName(name string) string {
+	if !p.IDN || name == "" {
+		return name
+	}
+	unicode, err := idnaProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
+
+// toAPI converts zone and the names of records with toAPIName. The input
+// records are left unchanged.
+func (p *Provider) toAPI(zone string, records []libdns.Record) (string, []libdns.Record, error) {
+	if !p.IDN {
+		return zone, records, nil
+	}
+
+	zone, err := p.toAPIName(zone)
+	if err != nil {
+		return "", nil, err
+	}
+
+	converted := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		if record.Name, err = p.toAPIName(record.Name); err != nil {
+			return "", nil, err
+		}
+		converted = append(converted, record)
+	}
+
+	return zone, converted, nil
+}
+
+// fromAPI converts the names of records with fromAPIName in place, names
+// apex records "@" if ApexAt is set, and returns them.
+func (p *Provider) fromAPI(records []libdns.Record) []libdns.Record {
+	if !p.IDN && !p.ApexAt {
+		return records
+	}
+	for i := range records {
+		records[i].Name = p.fromAPIName(records[i].Name)
+		if p.ApexAt && records[i].Name == "" {
+			records[i].Name = "@"
+		}
+	}
+	return records
+}
@@ -0,0 +1,72 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDN(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.xn--bcher-kva.example.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	p.IDN = true
+	ctx := context.Background()
+	zone := "bücher.example."
+
+	t.Run("AppendRecords", func(t *testing.T) {
+		result, err := p.AppendRecords(ctx, zone, []libdns.Record{{Name: "straße", Type: "A", Value: "10.0.0.2", TTL: time.Minute}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "straße", result[0].Name)
+		}
+		stored := api.snapshot()
+		assert.Equal(t, "xn--strae-oqa.xn--bcher-kva.example.", stored[len(stored)-1].Name)
+	})
+
+	t.Run("GetRecords", func(t *testing.T) {
+		result, err := p.GetRecords(ctx, zone)
+		assert.Nil(t, err)
+		if assert.Len(t, result, 2) {
+			assert.Equal(t, "www", result[0].Name)
+			assert.Equal(t, "straße", result[1].Name)
+		}
+		assert.Equal(t, 1, api.count("GET /dns/xn--bcher-kva.example./rr"))
+	})
+
+	t.Run("SetRecords", func(t *testing.T) {
+		result, err := p.SetRecords(ctx, zone, []libdns.Record{{Name: "straße", Type: "A", Value: "10.0.0.3", TTL: time.Minute}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "straße", result[0].Name)
+			assert.Equal(t, "10.0.0.3", result[0].Value)
+		}
+		assert.Len(t, api.snapshot(), 2)
+	})
+
+	t.Run("DeleteRecords", func(t *testing.T) {
+		result, err := p.DeleteRecords(ctx, zone, []libdns.Record{{Name: "straße", Type: "A", Value: "10.0.0.3"}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "straße", result[0].Name)
+		}
+		assert.Len(t, api.snapshot(), 1)
+	})
+}
+
+func TestIDNDisabled(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.xn--bcher-kva.example.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	result, err := api.provider().GetRecords(context.Background(), "xn--bcher-kva.example.")
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "www", result[0].Name)
+	}
+}
@@ -0,0 +1,144 @@
+package regfish
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LOC is the parsed value of a LOC record, which gives the geographic
+// location of a host. Distances are in meters.
+type LOC struct {
+	// Latitude is in degrees, negative south of the equator.
+	Latitude float64
+
+	// Longitude is in degrees, negative west of the prime meridian.
+	Longitude float64
+
+	// Altitude is relative to the WGS 84 reference spheroid.
+	Altitude float64
+
+	// Size is the diameter of a sphere enclosing the entity, 1 if not
+	// given.
+	Size float64
+
+	// HorizPrecision and VertPrecision are the precision of the
+	// position, 10000 and 10 if not given.
+	HorizPrecision float64
+	VertPrecision  float64
+}
+
+// ParseLOC parses the value of a LOC record in the form of RFC 1876, such
+// as "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m". Minutes and
+// seconds, the unit "m" and the size and precisions may be left out.
+func ParseLOC(value string) (LOC, error) {
+	fields := strings.Fields(value)
+	malformed := func(reason string) error {
+		return fmt.Errorf("malformed LOC value %q: %s", value, reason)
+	}
+
+	latitude, fields, err := parseLOCCoordinate(fields, "N", "S", 90)
+	if err != nil {
+		return LOC{}, malformed("latitude " + err.Error())
+	}
+	longitude, fields, err := parseLOCCoordinate(fields, "E", "W", 180)
+	if err != nil {
+		return LOC{}, malformed("longitude " + err.Error())
+	}
+	if len(fields) == 0 {
+		return LOC{}, malformed("missing altitude")
+	}
+	if len(fields) > 4 {
+		return LOC{}, malformed("too many fields")
+	}
+
+	loc := LOC{
+		Latitude:       latitude,
+		Longitude:      longitude,
+		Size:           1,
+		HorizPrecision: 10000,
+		VertPrecision:  10,
+	}
+	distances := []*float64{&loc.Altitude, &loc.Size, &loc.HorizPrecision, &loc.VertPrecision}
+	for i, field := range fields {
+		d, err := strconv.ParseFloat(strings.TrimSuffix(field, "m"), 64)
+		if err != nil {
+			return LOC{}, malformed(fmt.Sprintf("invalid distance %s", field))
+		}
+		*distances[i] = d
+	}
+	if loc.Altitude < -100000 || loc.Altitude > 42849672.95 {
+		return LOC{}, malformed("altitude out of range")
+	}
+	for _, d := range distances[1:] {
+		if *d < 0 || *d > 90000000 {
+			return LOC{}, malformed("size or precision out of range")
+		}
+	}
+	return loc, nil
+}
+
+// parseLOCCoordinate parses a latitude or longitude from the front of
+// fields, given as degrees, optionally followed by minutes and seconds,
+// and the hemisphere pos or neg. It returns the coordinate in degrees and
+// the fields left.
+func parseLOCCoordinate(fields []string, pos, neg string, max float64) (float64, []string, error) {
+	var parts []float64
+	for i, field := range fields {
+		if i > 3 {
+			break
+		}
+		if strings.EqualFold(field, pos) || strings.EqualFold(field, neg) {
+			if len(parts) == 0 {
+				return 0, nil, fmt.Errorf("is missing")
+			}
+			degrees := parts[0]
+			if len(parts) > 1 {
+				degrees += parts[1] / 60
+			}
+			if len(parts) > 2 {
+				degrees += parts[2] / 3600
+			}
+			if degrees > max {
+				return 0, nil, fmt.Errorf("is out of range")
+			}
+			if strings.EqualFold(field, neg) {
+				degrees = -degrees
+			}
+			return degrees, fields[i+1:], nil
+		}
+
+		limit := 60.0
+		if i == 0 {
+			limit = max + 1
+		}
+		n, err := strconv.ParseFloat(field, 64)
+		if err != nil || n < 0 || n >= limit || (i < 2 && n != math.Trunc(n)) {
+			return 0, nil, fmt.Errorf("has invalid part %s", field)
+		}
+		parts = append(parts, n)
+	}
+	return 0, nil, fmt.Errorf("has no hemisphere %s or %s", pos, neg)
+}
+
+// String returns the value of the LOC record with all fields, to the
+// precision LOC records hold: thousandths of arc seconds and centimeters.
+func (l LOC) String() string {
+	return fmt.Sprintf("%s %s %.2fm %.2fm %.2fm %.2fm",
+		formatLOCCoordinate(l.Latitude, "N", "S"),
+		formatLOCCoordinate(l.Longitude, "E", "W"),
+		l.Altitude, l.Size, l.HorizPrecision, l.VertPrecision)
+}
+
+// formatLOCCoordinate formats a coordinate in degrees as degrees, minutes,
+// seconds and hemisphere.
+func formatLOCCoordinate(degrees float64, pos, neg string) string {
+	hemisphere := pos
+	if degrees < 0 {
+		hemisphere = neg
+		degrees = -degrees
+	}
+	ms := int64(math.Round(degrees * 3600000))
+	return fmt.Sprintf("%d %d %.3f %s", ms/3600000, ms/60000%60, float64(ms%60000)/1000, hemisphere)
+}
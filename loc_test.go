@@ -0,0 +1,47 @@
+package regfish_test
+
+import (
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLOC(t *testing.T) {
+	loc, err := regfish.ParseLOC("52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m")
+	assert.Nil(t, err)
+	assert.InDelta(t, 52.373056, loc.Latitude, 1e-6)
+	assert.InDelta(t, 4.892222, loc.Longitude, 1e-6)
+	assert.Equal(t, -2.0, loc.Altitude)
+	assert.Equal(t, 0.0, loc.Size)
+	assert.Equal(t, "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000.00m 10.00m", loc.String())
+
+	loc, err = regfish.ParseLOC("42 21 S 71 W 24m")
+	assert.Nil(t, err)
+	assert.InDelta(t, -42.35, loc.Latitude, 1e-9)
+	assert.Equal(t, -71.0, loc.Longitude)
+	assert.Equal(t, "42 21 0.000 S 71 0 0.000 W 24.00m 1.00m 10000.00m 10.00m", loc.String())
+
+	for _, value := range []string{
+		"",
+		"52 22 23 N",
+		"91 N 4 E 0m",
+		"52 60 N 4 E 0m",
+		"52 22 N 181 E 0m",
+		"52 N 4 X 0m",
+		"52 N 4 E 0m 1m 1m 1m 1m",
+		"52 N 4 E high",
+		"52 N 4 E -200000m",
+	} {
+		_, err := regfish.ParseLOC(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestNormalizeLOC(t *testing.T) {
+	record := regfish.Normalize(libdns.Record{Name: "www", Type: "LOC", Value: "52 22 23 N 4 53 32 E -2m"}, test_zone)
+	assert.Equal(t, "52 22 23.000 N 4 53 32.000 E -2.00m 1.00m 10000.00m 10.00m", record.Value)
+
+	assert.NotNil(t, regfish.ValidateRecord(libdns.Record{Name: "www", Type: "LOC", Value: "52 22 23 N"}))
+}
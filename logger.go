@@ -0,0 +1,16 @@
+package regfish
+
+import "log"
+
+// Logger receives warnings of the Provider. A *log.Logger can be used.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logger returns Provider.Logger, or the standard logger if it is nil.
+func (p *Provider) logger() Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+	return log.Default()
+}
@@ -0,0 +1,245 @@
+package regfish
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// recordIndex looks up the records of a zone, as read once from the
+// regfish API, by ID and by name and type. SetRecords, UpsertRecords and
+// DeleteRecords all match records through it, so that they agree on which
+// live record a given record refers to.
+type recordIndex struct {
+	zone    string
+	records []rfns.Record
+	byID    map[int]int
+	byKey   map[string][]int
+
+	// claimed holds the IDs of records that records of the batch being
+	// written hold or were written to, which upsertTarget does not pick
+	// for other records.
+	claimed map[int]bool
+}
+
+// newRecordIndex indexes records of zone. The records are copied, so put
+// does not change the slice passed in, which may be cached.
+func newRecordIndex(records []rfns.Record, zone string) *recordIndex {
+	ix := &recordIndex{
+		zone:    zone,
+		byID:    make(map[int]int, len(records)),
+		byKey:   make(map[string][]int),
+		claimed: make(map[int]bool),
+	}
+	for _, rec := range records {
+		ix.put(rec)
+	}
+	return ix
+}
+
+// key returns the key records of the given name and type are indexed by.
+// The name may be relative to the zone or fully qualified.
+func (ix *recordIndex) key(name, recordType string) string {
+	return recordKey(fqdn(name, ix.zone), recordType)
+}
+
+// put adds rec to the index, replacing the record with the same ID, if
+// any. Records without an ID, as created in dry-run mode, are added.
+func (ix *recordIndex) put(rec rfns.Record) {
+	if i, ok := ix.byID[rec.ID]; ok && rec.ID != 0 {
+		old := ix.key(ix.records[i].Name, ix.records[i].Type)
+		ix.records[i] = rec
+		if key := ix.key(rec.Name, rec.Type); key != old {
+			ix.byKey[old] = removeIndex(ix.byKey[old], i)
+			ix.byKey[key] = append(ix.byKey[key], i)
+		}
+		return
+	}
+
+	i := len(ix.records)
+	ix.records = append(ix.records, rec)
+	if rec.ID != 0 {
+		ix.byID[rec.ID] = i
+	}
+	key := ix.key(rec.Name, rec.Type)
+	ix.byKey[key] = append(ix.byKey[key], i)
+}
+
+// removeIndex returns indexes without i.
+func removeIndex(indexes []int, i int) []int {
+	for j, index := range indexes {
+		if index == i {
+			return append(indexes[:j:j], indexes[j+1:]...)
+		}
+	}
+	return indexes
+}
+
+// recordID returns the regfish record ID that record carries in its ID
+// field, as the Provider returns records, or 0 if it has none. An ID that
+// is no regfish record ID is an error.
+func recordID(record libdns.Record) (int, error) {
+	if record.ID == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(record.ID)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("record %s of type %s has an invalid ID %q", record.Name, record.Type, record.ID)
+	}
+	return id, nil
+}
+
+// checkRecordIDs returns an error if any of the records has an ID that is
+// no regfish record ID.
+func checkRecordIDs(records []libdns.Record) error {
+	for _, record := range records {
+		if _, err := recordID(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// byRecordID returns the record with the ID of record, if set and present.
+func (ix *recordIndex) byRecordID(record libdns.Record) (rfns.Record, bool) {
+	id, err := recordID(record)
+	if err != nil || id == 0 {
+		return rfns.Record{}, false
+	}
+	i, ok := ix.byID[id]
+	if !ok {
+		return rfns.Record{}, false
+	}
+	return ix.records[i], true
+}
+
+// lookup returns the records of the same name and type as record, in the
+// order the regfish API listed them.
+func (ix *recordIndex) lookup(record libdns.Record) []rfns.Record {
+	indexes := ix.byKey[ix.key(record.Name, record.Type)]
+	records := make([]rfns.Record, 0, len(indexes))
+	for _, i := range indexes {
+		records = append(records, ix.records[i])
+	}
+	return records
+}
+
+// ErrAmbiguousRecord is returned, wrapped, by SetRecords for a record
+// that would update one of several records of the same name and type,
+// none of which holds its data and priority. Setting the ID of the record
+// picks the one to update.
+var ErrAmbiguousRecord = errors.New("record is ambiguous")
+
+// matchData returns those of records that hold the data of record and,
+// if withPriority is set and record has a priority, its priority. The
+// data is compared as given, as it would be written, e.g. with the
+// priority of an MX record taken from the front of its value, and as
+// RecordsEqual compares it, e.g. host names and hex data ignoring case.
+func (ix *recordIndex) matchData(records []rfns.Record, record libdns.Record, withPriority bool) []rfns.Record {
+	want := convertFromLibdnsRecord(record, ix.zone)
+	priority, _ := splitPriority(record)
+	withPriority = withPriority && hasPriority(record.Type) && priority != 0
+
+	var matched []rfns.Record
+	for _, rec := range records {
+		if rec.Data != record.Value && rec.Data != want.Data &&
+			normalizeValue(record.Type, rec.Data) != normalizeValue(record.Type, want.Data) {
+			continue
+		}
+		if withPriority && getPriority(rec.Priority) != priority {
+			continue
+		}
+		matched = append(matched, rec)
+	}
+	return matched
+}
+
+// claim marks the records that records hold already, by ID or by data and
+// priority, as claimed, so that upsertTarget leaves them to those records.
+func (ix *recordIndex) claim(records []libdns.Record) {
+	for _, record := range records {
+		if rec, ok := ix.byRecordID(record); ok {
+			ix.claimed[rec.ID] = true
+		} else if exact := ix.matchData(ix.lookup(record), record, true); len(exact) > 0 {
+			ix.claimed[exact[0].ID] = true
+		}
+	}
+}
+
+// unclaimed returns those of records that are not claimed. Records without
+// an ID, as created in dry-run mode, count as claimed.
+func (ix *recordIndex) unclaimed(records []rfns.Record) []rfns.Record {
+	var result []rfns.Record
+	for _, rec := range records {
+		if rec.ID != 0 && !ix.claimed[rec.ID] {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+// upsertTarget returns the record that upsertRecord updates for record:
+// the record with the ID of record, if set and present, and otherwise
+// among the records of the same name and type the first one holding the
+// data and priority of record, or of those not claimed by other records
+// of the batch the only one holding its data, or the only one. Records
+// holding the same data with different priorities, such as two MX records
+// of the same host, are only told apart by the priority. If several
+// records of the name and type remain to choose from, it returns an error
+// wrapping ErrAmbiguousRecord.
+func (ix *recordIndex) upsertTarget(record libdns.Record) (rfns.Record, bool, error) {
+	if rec, ok := ix.byRecordID(record); ok {
+		return rec, true, nil
+	}
+
+	candidates := ix.lookup(record)
+	if exact := ix.matchData(candidates, record, true); len(exact) > 0 {
+		if samePriority(exact) {
+			return exact[0], true, nil
+		}
+		candidates = exact
+	} else {
+		candidates = ix.unclaimed(candidates)
+		if sameData := ix.matchData(candidates, record, false); len(sameData) > 0 {
+			candidates = sameData
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return rfns.Record{}, false, nil
+	case 1:
+		return candidates[0], true, nil
+	}
+	return rfns.Record{}, false, fmt.Errorf("%w: %s of type %s matches %d records; set its ID to pick one", ErrAmbiguousRecord, record.Name, record.Type, len(candidates))
+}
+
+// deleteTargets returns the records that DeleteRecords deletes for
+// record: the record with the ID of record, if set and present, all
+// records of the same name and type if record has neither ID nor value,
+// and otherwise the first record of the same name and type that holds the
+// data and, if given, the priority of record.
+func (ix *recordIndex) deleteTargets(record libdns.Record) []rfns.Record {
+	if rec, ok := ix.byRecordID(record); ok {
+		return []rfns.Record{rec}
+	}
+	if record.ID == "" && record.Value == "" {
+		return ix.lookup(record)
+	}
+	if matched := ix.matchData(ix.lookup(record), record, true); len(matched) > 0 {
+		return matched[:1]
+	}
+	return nil
+}
+
+// samePriority reports whether all records have the same priority.
+func samePriority(records []rfns.Record) bool {
+	for _, rec := range records[1:] {
+		if getPriority(rec.Priority) != getPriority(records[0].Priority) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package regfish_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// mockAPI is an in-memory stand-in for the regfish DNS API.
+type mockAPI struct {
+	mu      sync.Mutex
+	records []rfns.Record
+	nextID  int
+	calls   map[string]int
+	server  *httptest.Server
+
+	// before, if set, is called for each request before it is handled.
+	before func(r *http.Request)
+
+	// after, if set, is called for each request once it is handled, but
+	// before the response is sent, so it can hold up a response that
+	// reflects the records at the time of the request.
+	after func(r *http.Request)
+
+	// onCreate, if set, may alter records before they are stored.
+	onCreate func(rec *rfns.Record)
+
+	// fail, if set, is called for each request; if it returns a non-zero
+	// status, the request fails with that status and body.
+	fail func(r *http.Request) (status int, body string)
+
+	// failHeader holds headers to send with failed requests.
+	failHeader http.Header
+
+	// response, if set, is called for each request; if it returns a
+	// non-empty body, the request succeeds with that body instead of
+	// being handled, e.g. to return fields the mock does not store.
+	response func(r *http.Request) string
+}
+
+// newMockAPI starts a mock regfish API serving the given records.
+func newMockAPI(t testing.TB, records ...rfns.Record) *mockAPI {
+	m := &mockAPI{
+		nextID: 1000,
+		calls:  make(map[string]int),
+	}
+	for _, rec := range records {
+		m.add(rec)
+	}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// provider returns a Provider talking to the mock API.
+func (m *mockAPI) provider() *regfish.Provider {
+	return &regfish.Provider{
+		APIToken: "test-token",
+		BaseURL:  m.server.URL,
+	}
+}
+
+// add stores a record, assigning an ID if it has none.
+func (m *mockAPI) add(rec rfns.Record) rfns.Record {
+	if rec.ID == 0 {
+		m.nextID++
+		rec.ID = m.nextID
+	}
+	m.records = append(m.records, rec)
+	return rec
+}
+
+// remove deletes the record with the given ID, as a concurrent client would.
+func (m *mockAPI) remove(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rec := range m.records {
+		if rec.ID == id {
+			m.records = append(m.records[:i], m.records[i+1:]...)
+			return
+		}
+	}
+}
+
+// count returns how often the given "METHOD /path" was requested.
+func (m *mockAPI) count(call string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[call]
+}
+
+// snapshot returns a copy of the records currently stored.
+func (m *mockAPI) snapshot() []rfns.Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]rfns.Record(nil), m.records...)
+}
+
+func (m *mockAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.before != nil {
+		m.before(r)
+	}
+	if m.after != nil {
+		defer m.after(r)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[r.Method+" "+r.URL.Path]++
+
+	if m.fail != nil {
+		if status, body := m.fail(r); status != 0 {
+			for key, values := range m.failHeader {
+				w.Header()[key] = values
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+	}
+
+	if m.response != nil {
+		if body := m.response(r); body != "" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "dns" && parts[2] == "rr":
+		suffix := "." + strings.TrimSuffix(parts[1], ".") + "."
+		var out []rfns.Record
+		for _, rec := range m.records {
+			if strings.HasSuffix(strings.ToLower("."+rec.Name), strings.ToLower(suffix)) {
+				out = append(out, rec)
+			}
+		}
+		m.respond(w, out)
+
+	case r.Method == http.MethodPost && path == "dns/rr":
+		var rec rfns.Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec.ID = 0
+		if m.onCreate != nil {
+			m.onCreate(&rec)
+		}
+		m.respond(w, m.add(rec))
+
+	case len(parts) == 3 && parts[0] == "dns" && parts[1] == "rr":
+		id, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		idx := -1
+		for i, rec := range m.records {
+			if rec.ID == id {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			m.respond(w, m.records[idx])
+		case http.MethodPatch:
+			var upd rfns.Record
+			if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			upd.ID = id
+			m.records[idx] = upd
+			m.respond(w, upd)
+		case http.MethodDelete:
+			m.records = append(m.records[:idx], m.records[idx+1:]...)
+			m.respond(w, nil)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (m *mockAPI) respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"response": v})
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,104 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordPatch holds the fields PatchRecord changes. Fields left nil keep
+// their current value.
+type RecordPatch struct {
+	Value    *string
+	TTL      *time.Duration
+	Priority *int
+
+	// Annotation is the comment regfish keeps with a record.
+	Annotation *string
+}
+
+// PatchRecord changes only the given fields of a single record in the
+// zone, keeping all others, including those libdns.Record cannot hold,
+// such as annotations. The record to change is identified by selector:
+// by its ID if set, and by its name, type and value otherwise, matched as
+// SetRecords matches records. The changed record is checked and converted
+// as SetRecords would write it. It returns the changed record.
+func (p *Provider) PatchRecord(ctx context.Context, zone string, selector libdns.Record, changes RecordPatch) (libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return libdns.Record{}, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return libdns.Record{}, err
+	}
+
+	zone, selected, err := p.toAPI(zone, []libdns.Record{selector})
+	if err != nil {
+		return libdns.Record{}, err
+	}
+	selector = selected[0]
+	defer p.invalidateCache(zone)
+
+	if IsForwardingRecord(selector) {
+		return libdns.Record{}, fmt.Errorf("record %s of type %s is a forwarding record and cannot be changed through the DNS API", selector.Name, selector.Type)
+	}
+	if err := checkRecordIDs(selected); err != nil {
+		return libdns.Record{}, err
+	}
+
+	records, err := p.getRecords(ctx, zone)
+	if err != nil {
+		return libdns.Record{}, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+	index := newRecordIndex(records, zone)
+
+	rec, ok := index.byRecordID(selector)
+	if !ok && selector.ID == "" {
+		if matched := index.matchData(index.lookup(selector), selector, true); len(matched) > 0 {
+			rec, ok = matched[0], true
+		}
+	}
+	if !ok {
+		return libdns.Record{}, fmt.Errorf("record %s of type %s with data %s not found", selector.Name, selector.Type, p.errorData(selector.Type, selector.Value))
+	}
+
+	patched := convertToLibdnsRecord(rec, zone)
+	if changes.Value != nil {
+		patched.Value = *changes.Value
+	}
+	if changes.TTL != nil {
+		patched.TTL = *changes.TTL
+	}
+	if changes.Priority != nil {
+		if !hasPriority(rec.Type) {
+			return libdns.Record{}, fmt.Errorf("record %s of type %s cannot have a priority (got %d)", selector.Name, rec.Type, *changes.Priority)
+		}
+		patched.Priority = *changes.Priority
+	}
+	if err := p.checkRecords([]libdns.Record{patched}); err != nil {
+		return libdns.Record{}, err
+	}
+
+	update := convertFromLibdnsRecord(patched, zone)
+	update.ID = rec.ID
+	update.Name = rec.Name
+	update.Annotation = rec.Annotation
+	update.Tag = rec.Tag
+	update.Flags = rec.Flags
+	if changes.Annotation != nil {
+		annotation := *changes.Annotation
+		update.Annotation = &annotation
+	}
+
+	updated, err := p.updateRecord(ctx, rec.ID, update)
+	if err != nil {
+		return libdns.Record{}, fmt.Errorf("failed to update record ID %d: %w", rec.ID, err)
+	}
+	return p.fromAPI([]libdns.Record{convertToLibdnsRecord(updated, zone)})[0], nil
+}
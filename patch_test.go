@@ -0,0 +1,105 @@
+package regfish_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchRecordTTL(t *testing.T) {
+	annotation := "web server"
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300, Annotation: &annotation},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+
+	ttl := time.Hour
+	result, err := api.provider().PatchRecord(context.Background(), test_zone,
+		libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"},
+		regfish.RecordPatch{TTL: &ttl})
+	assert.Nil(t, err)
+	assert.Equal(t, libdns.Record{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour}, result)
+
+	stored := api.snapshot()
+	assert.Equal(t, 3600, stored[0].TTL)
+	if assert.NotNil(t, stored[0].Annotation) {
+		assert.Equal(t, "web server", *stored[0].Annotation)
+	}
+	assert.Equal(t, 300, stored[1].TTL)
+}
+
+func TestPatchRecordPriority(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "MX", Data: "mx1.example.com.", TTL: 3600, Priority: intPtr(10)},
+		rfns.Record{Name: "example.com.", Type: "TXT", Data: "v=spf1 -all", TTL: 3600},
+	)
+	p := api.provider()
+
+	priority := 20
+	result, err := p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{ID: "1001"},
+		regfish.RecordPatch{Priority: &priority})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, result.Priority)
+	assert.Equal(t, "mx1.example.com.", result.Value)
+	assert.Equal(t, time.Hour, result.TTL)
+
+	_, err = p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{Name: "", Type: "TXT", Value: "v=spf1 -all"},
+		regfish.RecordPatch{Priority: &priority})
+	assert.Error(t, err)
+
+	_, err = p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{Name: "", Type: "MX", Value: "mx2.example.com."},
+		regfish.RecordPatch{Priority: &priority})
+	assert.Error(t, err)
+}
+
+func TestPatchRecordMatching(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "CNAME", Data: "web.example.net.", TTL: 300},
+		rfns.Record{Name: "dkim.example.com.", Type: "TXT", Data: `"` + strings.Repeat("a", 255) + `" "b"`, TTL: 300},
+	)
+	p := api.provider()
+	ttl := time.Hour
+
+	// Selectors are matched as SetRecords matches records.
+	for _, selector := range []libdns.Record{
+		{Name: "WWW", Type: "AAAA", Value: "2001:DB8:0::1"},
+		{Name: "www", Type: "CNAME", Value: "Web.example.net"},
+		{Name: "dkim", Type: "TXT", Value: strings.Repeat("a", 255) + "b"},
+	} {
+		_, err := p.PatchRecord(context.Background(), test_zone, selector, regfish.RecordPatch{TTL: &ttl})
+		assert.Nil(t, err, selector.Value)
+	}
+	for _, rec := range api.snapshot() {
+		assert.Equal(t, 3600, rec.TTL, rec.Name)
+	}
+
+	// New values are written as SetRecords writes them.
+	value := strings.Repeat("c", 300)
+	result, err := p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{ID: "1003"}, regfish.RecordPatch{Value: &value})
+	assert.Nil(t, err)
+	assert.Equal(t, value, result.Value)
+	assert.Equal(t, regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Value: value}, test_zone).Data, api.snapshot()[2].Data)
+
+	// and checked like them.
+	p.PreValidate = true
+	value = "not-an-address"
+	_, err = p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{ID: "1001"}, regfish.RecordPatch{Value: &value})
+	assert.ErrorContains(t, err, "not an IPv6 address")
+	assert.Equal(t, "2001:db8::1", api.snapshot()[0].Data)
+
+	_, err = p.PatchRecord(context.Background(), test_zone,
+		libdns.Record{ID: "abc"}, regfish.RecordPatch{TTL: &ttl})
+	assert.ErrorContains(t, err, "invalid ID")
+}
@@ -0,0 +1,155 @@
+package regfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// DeletePlan is a set of records resolved for deletion by BuildDeletePlan,
+// to be reviewed before it is carried out by ApplyDeletePlan.
+type DeletePlan struct {
+	// Zone is the zone the records belong to.
+	Zone string
+
+	// Records are the records to delete as they were found in the zone,
+	// each with its ID.
+	Records []libdns.Record
+}
+
+// BuildDeletePlan looks up the records to delete in the zone, matching
+// them as DeleteRecords does, and returns the records found without
+// deleting anything. It fails if any record cannot be deleted, just as
+// DeleteRecords would.
+func (p *Provider) BuildDeletePlan(ctx context.Context, zone string, records []libdns.Record) (*DeletePlan, error) {
+	ctx, cancel := withTimeout(ctx, p.ReadTimeout)
+	defer cancel()
+
+	if !p.UnlockedReads {
+		unlock, err := p.rlock(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	apiZone, records, err := p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	all_records, err := p.getRecords(ctx, apiZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records for zone %s: %w", apiZone, err)
+	}
+
+	ops, err := p.resolveDeletes(ctx, apiZone, all_records, records)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DeletePlan{Zone: zone}
+	for _, op := range ops {
+		for _, rec := range all_records {
+			if rec.ID == op.rrid {
+				plan.Records = append(plan.Records, convertToLibdnsRecord(rec, apiZone))
+				break
+			}
+		}
+	}
+	plan.Records = p.fromAPI(plan.Records)
+
+	return plan, nil
+}
+
+// ErrStalePlan is returned, wrapped, by ApplyDeletePlan for a plan with a
+// record that changed since the plan was built.
+var ErrStalePlan = errors.New("delete plan is stale")
+
+// ApplyDeletePlan deletes the records of plan by their IDs and returns the
+// records deleted. The zone is read again first: records that have
+// vanished since the plan was built are skipped without error and left
+// out of the result, and if a record now holds another name, type, value
+// or priority than planned, nothing is deleted and an error matching
+// ErrStalePlan is returned. Protected records are refused as by
+// DeleteRecords.
+func (p *Provider) ApplyDeletePlan(ctx context.Context, plan *DeletePlan) ([]libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, plan.Zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	zone, records, err := p.toAPI(plan.Zone, plan.Records)
+	if err != nil {
+		return nil, err
+	}
+	defer p.invalidateCache(zone)
+
+	for _, record := range records {
+		if !forceDelete(ctx) && isProtected(record.Name, record.Type, zone) {
+			return nil, protectedError(record.Type, zone)
+		}
+		if id, err := recordID(record); err != nil {
+			return nil, err
+		} else if id == 0 {
+			return nil, fmt.Errorf("record %s of type %s has no ID", record.Name, record.Type)
+		}
+	}
+
+	all_records, err := p.getRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+	index := newRecordIndex(all_records, zone)
+
+	var ops []deleteOp
+	for _, record := range records {
+		live, ok := index.byRecordID(record)
+		if !ok {
+			continue
+		}
+		if index.key(live.Name, live.Type) != index.key(record.Name, record.Type) ||
+			len(index.matchData([]rfns.Record{live}, record, true)) == 0 {
+			return nil, fmt.Errorf("%w: record ID %d is now %s of type %s with data %s", ErrStalePlan,
+				live.ID, stripZone(live.Name, zone), live.Type, p.errorData(live.Type, live.Data))
+		}
+		ops = append(ops, deleteOp{rrid: live.ID, record: record})
+	}
+	if !forceDelete(ctx) {
+		deleted := make(map[int]bool, len(ops))
+		for _, op := range ops {
+			deleted[op.rrid] = true
+		}
+		if err := checkGlue(all_records, deleted, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	var deletedRecords []libdns.Record
+	for _, op := range ops {
+		err := p.deleteRecord(ctx, op.rrid)
+		if statusCode(err) == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return p.fromAPI(deletedRecords), fmt.Errorf("failed to delete record ID %d: %w", op.rrid, err)
+		}
+		deletedRecords = append(deletedRecords, op.record)
+	}
+
+	return p.fromAPI(deletedRecords), nil
+}
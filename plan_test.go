@@ -0,0 +1,136 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletePlan(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "b.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "c.example.com.", Type: "A", Data: "10.0.0.3", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	plan, err := p.BuildDeletePlan(ctx, test_zone, []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+		{ID: "1003"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &regfish.DeletePlan{Zone: test_zone, Records: []libdns.Record{
+		{ID: "1001", Name: "a", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{ID: "1003", Name: "c", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+	}}, plan)
+	assert.Len(t, api.snapshot(), 3)
+
+	deleted, err := p.ApplyDeletePlan(ctx, plan)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.Records, deleted)
+	if assert.Len(t, api.snapshot(), 1) {
+		assert.Equal(t, 1002, api.snapshot()[0].ID)
+	}
+}
+
+func TestDeletePlanStale(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "b.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	plan, err := p.BuildDeletePlan(ctx, test_zone, []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+		{Name: "b", Type: "A", Value: "10.0.0.2"},
+	})
+	assert.Nil(t, err)
+
+	api.remove(1001)
+
+	deleted, err := p.ApplyDeletePlan(ctx, plan)
+	assert.Nil(t, err)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, "1002", deleted[0].ID)
+	}
+	assert.Empty(t, api.snapshot())
+}
+
+func TestDeletePlanNotFound(t *testing.T) {
+	api := newMockAPI(t)
+
+	plan, err := api.provider().BuildDeletePlan(context.Background(), test_zone, []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestDeletePlanWholeRRset(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	plan, err := p.BuildDeletePlan(ctx, test_zone, []libdns.Record{
+		{Name: "www", Type: "A"},
+		{Name: "api", Type: "A"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{ID: "1002", Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+	}, plan.Records)
+
+	deleted, err := p.ApplyDeletePlan(ctx, plan)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.Records, deleted)
+	if assert.Len(t, api.snapshot(), 1) {
+		assert.Equal(t, "AAAA", api.snapshot()[0].Type)
+	}
+}
+
+func TestDeletePlanChanged(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "b.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	plan, err := p.BuildDeletePlan(ctx, test_zone, []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+		{Name: "b", Type: "A", Value: "10.0.0.2"},
+	})
+	assert.Nil(t, err)
+
+	// The second record is given another address after planning.
+	api.mu.Lock()
+	api.records[1].Data = "10.0.0.9"
+	api.mu.Unlock()
+
+	deleted, err := p.ApplyDeletePlan(ctx, plan)
+	assert.ErrorIs(t, err, regfish.ErrStalePlan)
+	assert.ErrorContains(t, err, "record ID 1002")
+	assert.Empty(t, deleted)
+	assert.Len(t, api.snapshot(), 2)
+
+	// Once the plan holds the new address, the name matching regardless
+	// of case, it applies.
+	plan.Records[1].Value = "10.0.0.9"
+	plan.Records[0].Name = "A"
+	deleted, err = p.ApplyDeletePlan(ctx, plan)
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 2)
+	assert.Empty(t, api.snapshot())
+}
@@ -0,0 +1,31 @@
+package regfish
+
+// MismatchPolicy says how a check treats a record regfish returned that
+// does not match the request, such as one stored with a rounded TTL or
+// created under another name. The zero value ignores mismatches.
+type MismatchPolicy int
+
+const (
+	// MismatchIgnore accepts the record without checking it.
+	MismatchIgnore MismatchPolicy = iota
+
+	// MismatchWarn logs a warning to Provider.Logger and accepts the
+	// record.
+	MismatchWarn
+
+	// MismatchError fails the write.
+	MismatchError
+)
+
+// String returns the name of the policy.
+func (m MismatchPolicy) String() string {
+	switch m {
+	case MismatchIgnore:
+		return "ignore"
+	case MismatchWarn:
+		return "warn"
+	case MismatchError:
+		return "error"
+	}
+	return "unknown"
+}
@@ -0,0 +1,222 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// defaultPropagationInterval is the default for PropagationCheck.Interval.
+const defaultPropagationInterval = 2 * time.Second
+
+// defaultPropagationTimeout is the default for PropagationCheck.Timeout.
+const defaultPropagationTimeout = 2 * time.Minute
+
+// Resolver looks up published DNS records.
+type Resolver interface {
+	// Lookup returns the values of the records of the given type at the
+	// fully qualified name, each formatted as the Value of a libdns.Record
+	// of that type would be, e.g. "10.0.0.1" for an A record.
+	Lookup(ctx context.Context, name, recordType string) ([]string, error)
+}
+
+// NetResolver is a Resolver backed by a *net.Resolver, which supports A,
+// AAAA, CNAME, MX, NS and TXT records. To see changes as soon as they are
+// published, point it at the authoritative regfish name servers rather
+// than a caching resolver.
+type NetResolver struct {
+	// Resolver is used for lookups. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+}
+
+// Lookup implements Resolver.
+func (r NetResolver) Lookup(ctx context.Context, name, recordType string) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA":
+		network := "ip4"
+		if strings.EqualFold(recordType, "AAAA") {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			values = append(values, ip.String())
+		}
+		return values, nil
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return []string{cname}, nil
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(mxs))
+		for _, mx := range mxs {
+			values = append(values, mx.Host)
+		}
+		return values, nil
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(nss))
+		for _, ns := range nss {
+			values = append(values, ns.Host)
+		}
+		return values, nil
+	case "TXT":
+		return resolver.LookupTXT(ctx, name)
+	}
+	return nil, fmt.Errorf("lookup of %s records is not supported", recordType)
+}
+
+// PropagationCheck configures the propagation check of
+// AppendRecordsAndCheck and SetRecordsAndCheck.
+type PropagationCheck struct {
+	// Resolver looks up the written records. Defaults to NetResolver{}.
+	Resolver Resolver
+
+	// Interval is the pause between lookups. Defaults to 2 seconds.
+	Interval time.Duration
+
+	// Timeout limits how long to wait for the records to be published.
+	// Defaults to 2 minutes.
+	Timeout time.Duration
+}
+
+// PropagationResult is the outcome of a propagation check.
+type PropagationResult struct {
+	// Propagated reports whether all written records were found.
+	Propagated bool
+
+	// Duration is how long the check took.
+	Duration time.Duration
+
+	// Lookups is how many rounds of lookups were made.
+	Lookups int
+}
+
+// AppendRecordsAndCheck adds records to the zone with AppendRecords and
+// then, if check is not nil, waits until the resolver of check returns
+// all of them, as an ACME challenge solver would before asking for
+// validation. It returns the added records and the result of the check,
+// which is nil if check is nil or nothing was written in dry-run mode. If
+// the records do not show up in time, the added records are returned
+// together with the result and an error.
+func (p *Provider) AppendRecordsAndCheck(ctx context.Context, zone string, records []libdns.Record, check *PropagationCheck) ([]libdns.Record, *PropagationResult, error) {
+	added, err := p.AppendRecords(ctx, zone, records)
+	if err != nil || check == nil || p.dryRun(ctx) {
+		return added, nil, err
+	}
+	result, err := p.checkPropagation(ctx, zone, records, check)
+	return added, result, err
+}
+
+// SetRecordsAndCheck sets records in the zone with SetRecords and then
+// checks their propagation like AppendRecordsAndCheck.
+func (p *Provider) SetRecordsAndCheck(ctx context.Context, zone string, records []libdns.Record, check *PropagationCheck) ([]libdns.Record, *PropagationResult, error) {
+	set, err := p.SetRecords(ctx, zone, records)
+	if err != nil || check == nil || p.dryRun(ctx) {
+		return set, nil, err
+	}
+	result, err := p.checkPropagation(ctx, zone, records, check)
+	return set, result, err
+}
+
+// checkPropagation looks up records until all of them are found, or the
+// timeout of check or ctx ends the check.
+func (p *Provider) checkPropagation(ctx context.Context, zone string, records []libdns.Record, check *PropagationCheck) (*PropagationResult, error) {
+	zone, records, err := p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := check.Resolver
+	if resolver == nil {
+		resolver = NetResolver{}
+	}
+	interval := check.Interval
+	if interval <= 0 {
+		interval = defaultPropagationInterval
+	}
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultPropagationTimeout
+	}
+	// The timeout bounds the lookups themselves as well, in case the
+	// resolver hangs; the pauses between them are measured with the Clock.
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	clock := p.clock()
+	start := clock.Now()
+	result := &PropagationResult{}
+	for {
+		result.Lookups++
+		result.Propagated = propagated(lookupCtx, resolver, zone, records)
+		result.Duration = clock.Now().Sub(start)
+		if result.Propagated {
+			return result, nil
+		}
+		if err := lookupCtx.Err(); err != nil {
+			return result, fmt.Errorf("records not propagated after %s: %w", result.Duration.Round(time.Millisecond), err)
+		}
+
+		remaining := timeout - result.Duration
+		if remaining <= 0 {
+			return result, fmt.Errorf("records not propagated after %s: %w", result.Duration.Round(time.Millisecond), context.DeadlineExceeded)
+		}
+		if remaining > interval {
+			remaining = interval
+		}
+		if err := p.sleep(ctx, remaining); err != nil {
+			result.Duration = clock.Now().Sub(start)
+			return result, fmt.Errorf("records not propagated after %s: %w", result.Duration.Round(time.Millisecond), err)
+		}
+	}
+}
+
+// propagated reports whether resolver returns all records. Only the data
+// of records is compared, without the priority of, e.g., MX and SRV
+// records, which may or may not be at the front of the values the resolver
+// returns.
+func propagated(ctx context.Context, resolver Resolver, zone string, records []libdns.Record) bool {
+	for _, record := range records {
+		values, err := resolver.Lookup(ctx, fqdn(record.Name, zone), record.Type)
+		if err != nil {
+			return false
+		}
+
+		_, data := splitPriority(record)
+		want := normalizeValue(record.Type, data)
+		found := false
+		for _, value := range values {
+			_, data := splitPriority(libdns.Record{Type: record.Type, Value: value})
+			if normalizeValue(record.Type, data) == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
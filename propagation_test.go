@@ -0,0 +1,150 @@
+package regfish_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubResolver publishes the records of a mockAPI after a number of
+// lookups.
+type stubResolver struct {
+	mu      sync.Mutex
+	api     *mockAPI
+	delay   int
+	lookups int
+}
+
+func (r *stubResolver) Lookup(ctx context.Context, name, recordType string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.lookups <= r.delay {
+		return nil, nil
+	}
+
+	var values []string
+	for _, rec := range r.api.snapshot() {
+		if rec.Name == name && rec.Type == recordType {
+			values = append(values, rec.Data)
+		}
+	}
+	return values, nil
+}
+
+func TestAppendRecordsAndCheck(t *testing.T) {
+	api := newMockAPI(t)
+	resolver := &stubResolver{api: api, delay: 2}
+
+	records, result, err := api.provider().AppendRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: resolver, Interval: time.Millisecond})
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	if assert.NotNil(t, result) {
+		assert.True(t, result.Propagated)
+		assert.Equal(t, 3, result.Lookups)
+		assert.Greater(t, result.Duration, time.Duration(0))
+	}
+}
+
+func TestSetRecordsAndCheckTimeout(t *testing.T) {
+	api := newMockAPI(t)
+	resolver := &stubResolver{api: api, delay: 1 << 30}
+
+	records, result, err := api.provider().SetRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: resolver, Interval: time.Millisecond, Timeout: 20 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, records, 1)
+	if assert.NotNil(t, result) {
+		assert.False(t, result.Propagated)
+		assert.Greater(t, result.Lookups, 1)
+	}
+}
+
+// hangingResolver blocks every lookup until its context ends.
+type hangingResolver struct{}
+
+func (hangingResolver) Lookup(ctx context.Context, name, recordType string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSetRecordsAndCheckHangingResolver(t *testing.T) {
+	api := newMockAPI(t)
+
+	start := time.Now()
+	_, result, err := api.provider().SetRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: hangingResolver{}, Interval: time.Millisecond, Timeout: 20 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	if assert.NotNil(t, result) {
+		assert.False(t, result.Propagated)
+		assert.Equal(t, 1, result.Lookups)
+	}
+}
+
+func TestSetRecordsAndCheckSkipped(t *testing.T) {
+	api := newMockAPI(t)
+
+	records, result, err := api.provider().SetRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.Nil(t, result)
+}
+
+func TestAppendRecordsAndCheckDefaultResolver(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.Clock = newFakeClock()
+
+	// NetResolver cannot look up CAA records, so the check fails without
+	// going to the network.
+	records, result, err := p.AppendRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "", Type: "CAA", Value: `0 issue "letsencrypt.org"`, TTL: time.Minute},
+	}, &regfish.PropagationCheck{Timeout: time.Second})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, records, 1)
+	if assert.NotNil(t, result) {
+		assert.False(t, result.Propagated)
+		assert.Greater(t, result.Lookups, 1)
+	}
+}
+
+func TestAppendRecordsAndCheckPriority(t *testing.T) {
+	api := newMockAPI(t)
+	resolver := &stubResolver{api: api}
+
+	records, result, err := api.provider().AppendRecordsAndCheck(context.Background(), test_zone, []libdns.Record{
+		{Name: "", Type: "MX", Value: "10 mx.example.com.", TTL: time.Minute},
+		{Name: "_sip._tcp", Type: "SRV", Value: "10 5 5060 sip.example.com.", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: resolver, Interval: time.Millisecond, Timeout: time.Second})
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	if assert.NotNil(t, result) {
+		assert.True(t, result.Propagated)
+		assert.Equal(t, 1, result.Lookups)
+	}
+}
+
+func TestAppendRecordsAndCheckDryRun(t *testing.T) {
+	api := newMockAPI(t)
+	resolver := &stubResolver{api: api}
+
+	records, result, err := api.provider().AppendRecordsAndCheck(regfish.WithDryRun(context.Background(), true), test_zone, []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token", TTL: time.Minute},
+	}, &regfish.PropagationCheck{Resolver: resolver, Interval: time.Millisecond})
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.Nil(t, result)
+	assert.Zero(t, resolver.lookups)
+}
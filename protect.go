@@ -0,0 +1,80 @@
+package regfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// ErrProtectedRecord is returned, wrapped, when DeleteRecords is asked to
+// delete an NS or SOA record at the zone apex, which would break the
+// delegation of the zone, or the last glue record of a name server a
+// delegation within the zone relies on.
+var ErrProtectedRecord = errors.New("record is protected")
+
+type forceDeleteKey struct{}
+
+// WithForceDelete returns a context that lets deletions made with it
+// remove NS and SOA records at the zone apex and glue records, which are
+// protected otherwise.
+func WithForceDelete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceDeleteKey{}, true)
+}
+
+// forceDelete reports whether protected records may be deleted by a call
+// made with ctx.
+func forceDelete(ctx context.Context) bool {
+	force, _ := ctx.Value(forceDeleteKey{}).(bool)
+	return force
+}
+
+// isProtected reports whether a record of the given name and type in zone
+// is protected from deletion: the NS and SOA records at the apex.
+func isProtected(name, recordType, zone string) bool {
+	if stripZone(name, zone) != "" {
+		return false
+	}
+	switch strings.ToUpper(recordType) {
+	case "NS", "SOA":
+		return true
+	}
+	return false
+}
+
+// protectedError returns the error for an attempt to delete a protected
+// record of the given type.
+func protectedError(recordType, zone string) error {
+	return fmt.Errorf("refusing to delete %s record at the apex of zone %s, which would break its delegation; use WithForceDelete to delete it anyway: %w", strings.ToUpper(recordType), zone, ErrProtectedRecord)
+}
+
+// checkGlue returns an error if deleting the records with the IDs in
+// deleted from the zone holding all would leave a name server inside the
+// zone without any address while a delegation that is kept relies on it.
+// The glue of a delegation whose NS records are deleted as well is not
+// protected, nor is glue that keeps at least one address.
+func checkGlue(all []rfns.Record, deleted map[int]bool, zone string) error {
+	var kept []libdns.Record
+	addressed := make(map[string]bool)
+	for _, rec := range all {
+		address := strings.EqualFold(rec.Type, "A") || strings.EqualFold(rec.Type, "AAAA")
+		if deleted[rec.ID] && !address {
+			continue
+		}
+		record := convertToLibdnsRecord(rec, zone)
+		kept = append(kept, record)
+		if address && !deleted[rec.ID] {
+			addressed[strings.ToLower(record.Name)] = true
+		}
+	}
+
+	for _, glue := range GlueRecords(kept, zone) {
+		if !addressed[strings.ToLower(glue.Name)] {
+			return fmt.Errorf("refusing to delete the last glue record of name server %s, which a delegation in zone %s relies on; change the NS records first or use WithForceDelete to delete it anyway: %w", fqdn(glue.Name, zone), zone, ErrProtectedRecord)
+		}
+	}
+	return nil
+}
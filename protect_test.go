@@ -0,0 +1,51 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteProtectedRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "NS", Data: "ns1.regfish.de.", TTL: 86400},
+		rfns.Record{Name: "example.com.", Type: "SOA", Data: "ns1.regfish.de. hostmaster.regfish.de. 1 3600 900 604800 300", TTL: 86400},
+		rfns.Record{Name: "sub.example.com.", Type: "NS", Data: "ns1.example.net.", TTL: 86400},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	for _, records := range [][]libdns.Record{
+		{{Name: "www", Type: "A", Value: "10.0.0.1"}, {Name: "", Type: "NS", Value: "ns1.regfish.de."}},
+		{{Name: "@", Type: "soa", Value: "ns1.regfish.de. hostmaster.regfish.de. 1 3600 900 604800 300"}},
+		{{ID: "1001"}},
+	} {
+		result, err := p.DeleteRecords(ctx, test_zone, records)
+		assert.ErrorIs(t, err, regfish.ErrProtectedRecord)
+		assert.Empty(t, result)
+		assert.Len(t, api.snapshot(), 4)
+	}
+
+	// Delegations of subdomains are not protected.
+	result, err := p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "sub", Type: "NS", Value: "ns1.example.net."}})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+}
+
+func TestDeleteProtectedRecordsForced(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "NS", Data: "ns1.regfish.de.", TTL: 86400},
+	)
+
+	result, err := api.provider().DeleteRecords(regfish.WithForceDelete(context.Background()), test_zone, []libdns.Record{
+		{Name: "", Type: "NS", Value: "ns1.regfish.de."},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.Empty(t, api.snapshot())
+}
@@ -5,6 +5,7 @@ package regfish
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,144 +13,788 @@ import (
 	rfns "github.com/regfish/regfish-dnsapi-go"
 )
 
+// defaultUpsertAttempts is the default for Provider.UpsertAttempts.
+const defaultUpsertAttempts = 3
+
+// defaultMaxConcurrentRequests is the default for
+// Provider.MaxConcurrentRequests.
+const defaultMaxConcurrentRequests = 4
+
+// defaultWaveInterval is the pause between waves of AppendRecords if
+// Provider.AppendWaveLimiter is nil.
+const defaultWaveInterval = time.Second
+
+// Limiter paces requests to the regfish API.
+type Limiter interface {
+	// Wait blocks until the next request may be made or ctx is done.
+	Wait(ctx context.Context) error
+}
+
 // Provider facilitates DNS record manipulation with regfish.
 type Provider struct {
 	APIToken string
-	client   rfns.Client
-	once     sync.Once
-	mutex    sync.Mutex
+
+	// BaseURL overrides the regfish API endpoint. Defaults to the
+	// endpoint of the regfish client library when empty.
+	BaseURL string
+
+	// SortRecords makes GetRecords return records sorted by name, type
+	// and value, which keeps the output stable for diffs. By default,
+	// records are returned in the order the regfish API lists them,
+	// matching the order shown in the regfish web interface.
+	SortRecords bool
+
+	// UnlockedReads lets GetRecords run without taking the lock of the
+	// zone. GetRecords performs a single read and no read-modify-write, so
+	// this is safe, but a read running alongside a write may or may not
+	// observe the write. By default, reads share a read lock with each
+	// other and wait for running writes to the zone to finish. Writes to a
+	// zone are always serialized; writes to different zones are not.
+	UnlockedReads bool
+
+	// MaxRecordsPerName limits how many records AppendRecords, SetRecords
+	// and UpsertRecords may leave at a single name, guarding against
+	// runaway automation. The records kept and created are counted, and
+	// the batch is rejected before any change is made if it would exceed
+	// the limit. Zero means unlimited.
+	MaxRecordsPerName int
+
+	// StrictPriority makes AppendRecords and SetRecords reject records
+	// with a non-zero Priority whose type has no priority (anything but
+	// MX, SRV, URI, HTTPS and SVCB). By default, such a priority is
+	// silently ignored and not sent to regfish.
+	StrictPriority bool
+
+	// PreValidate makes AppendRecords and SetRecords check every record of
+	// a batch with ValidateRecord before making any change, and fail with
+	// the first error found. By default, records are passed to regfish
+	// as they are, and a batch stops at the first record regfish rejects.
+	PreValidate bool
+
+	// UpsertAttempts is how often SetRecords tries to write a record when
+	// the zone changes concurrently between reading it and writing the
+	// record. Defaults to 3.
+	UpsertAttempts int
+
+	// RefetchEmptyZone makes SetRecords and UpsertRecords read a zone a
+	// second time if it has no records at all, before creating records
+	// that would otherwise have updated existing ones. This guards against
+	// duplicates should regfish transiently return an empty zone, at the
+	// cost of an extra request for zones that are really empty. Disabled
+	// by default.
+	RefetchEmptyZone bool
+
+	// RetryBackoff is the delay before the first retry of a write, which
+	// doubles with each further retry, up to 30 seconds. Defaults to
+	// 100ms.
+	RetryBackoff time.Duration
+
+	// RetryJitter randomizes retry delays, so that many Provider
+	// instances, e.g. a fleet of certificate renewal agents, do not retry
+	// in lockstep after a regfish outage. Defaults to FullJitter.
+	RetryJitter Jitter
+
+	// RetryPolicies overrides UpsertAttempts and RetryBackoff for records
+	// of the types it is keyed by, e.g. to retry ACME challenge TXT records
+	// harder than other writes. Type keys are case-insensitive; keys that
+	// differ only in case, such as "txt" and "TXT", are an error. Fields a
+	// policy leaves zero fall back to the settings above, and those to
+	// their defaults.
+	RetryPolicies map[string]RetryPolicy
+
+	// RequestAttempts is how often a single request to the regfish API is
+	// made in total when it fails with a rate limit (429) or server error
+	// (5xx), waiting between attempts as the Retry-After header of the
+	// response says, up to 30 seconds, or RequestBackoff, doubled with
+	// each retry, otherwise. Requests creating records are only retried
+	// when rate limited, as a create that failed with a server error may
+	// have been made; a retried delete that finds the record gone counts
+	// as done. Maintenance (503), which regfish reports before handling a
+	// request, is retried for all requests. Other errors, such as 400,
+	// fail at once.
+	// Defaults to 3; set it to 1 to disable retries.
+	RequestAttempts int
+
+	// RequestBackoff is the delay before the first retry of a request
+	// without Retry-After header, randomized as RetryJitter says. Defaults
+	// to 500ms.
+	RequestBackoff time.Duration
+
+	// AppendWaveSize splits AppendRecords batches into waves of at most
+	// this many records, pausing between waves so that provisioning
+	// hundreds of records stays within the regfish API rate limit. Zero
+	// disables splitting.
+	AppendWaveSize int
+
+	// AppendWaveLimiter is waited on before each wave after the first. A
+	// *rate.Limiter from golang.org/x/time/rate can be used. If nil,
+	// waves are one second apart.
+	AppendWaveLimiter Limiter
+
+	// AppendProgress, if set, is called after each wave of AppendRecords
+	// with the number of records created so far and the batch size.
+	AppendProgress func(done, total int)
+
+	// CacheTTL enables caching the records GetRecords fetches for a zone
+	// for the given duration. Writes through this Provider invalidate the
+	// cache of their zone, but changes made elsewhere, e.g. in the regfish
+	// web interface, may go unnoticed until the cached records expire. Use
+	// WithoutCache for reads that must see the current state. Disabled by
+	// default.
+	CacheTTL time.Duration
+
+	// MaxConcurrentRequests limits how many requests to the regfish API
+	// may be in flight at once across all operations of this Provider,
+	// independent of how fast they are made. Defaults to 4.
+	MaxConcurrentRequests int
+
+	// IDN enables support for internationalized domain names: zone and
+	// record names may be given in Unicode and are converted to punycode
+	// for the regfish API, and names returned by regfish are converted
+	// back to Unicode. Disabled by default, so names are passed as is.
+	IDN bool
+
+	// ApexAt makes the provider return records at the zone apex with the
+	// name "@" instead of "". Records below the apex keep their name
+	// relative to the zone either way, such as "host.sub" for
+	// "host.sub.example.com." in zone "example.com.". Disabled by default,
+	// following the libdns convention.
+	ApexAt bool
+
+	// DryRun makes AppendRecords, SetRecords, DeleteRecords and the other
+	// writing methods skip all changes and only return the records they
+	// would have created, updated or deleted. Records that would be
+	// created have no ID. Reads are still performed. WithDryRun overrides
+	// this setting for a single call.
+	DryRun bool
+
+	// RedactSensitive keeps the data of records that may hold secrets,
+	// such as TXT, TLSA or DNSKEY records, out of error messages, which
+	// tend to end up in logs. Only the length of the data is reported.
+	// By default, errors include the full data to ease debugging.
+	RedactSensitive bool
+
+	// ReadTimeout limits how long GetRecords and the other reading methods
+	// may take, so that a hot read path fails fast when regfish is slow.
+	// It applies on top of the context passed in: whichever deadline comes
+	// first ends the call. Zero means no limit besides the context.
+	ReadTimeout time.Duration
+
+	// SkipUnchanged makes SetRecords skip writing records that regfish
+	// already holds exactly as given, which spares polling-style callers
+	// that set the same records over and over needless writes. Combined
+	// with CacheTTL, the records are compared to the cached ones, so that
+	// a repeated call within the TTL makes no request at all; a record
+	// changed elsewhere in the meantime is then not restored until the
+	// cache expires. Disabled by default.
+	SkipUnchanged bool
+
+	// ReplaceRRsets makes SetRecords replace whole record sets, as the
+	// libdns contract describes: for every name and type among the
+	// records given, records of that name and type that were not given
+	// are deleted, so that setting a single A record removes other A
+	// records of the name. Live records are reused where possible, and
+	// IDs of the given records are ignored. Apex NS and SOA records are
+	// protected as in DeleteRecords. A record set changed concurrently is
+	// not retried. Disabled by default, so SetRecords only creates and
+	// updates records.
+	ReplaceRRsets bool
+
+	// IgnoreMissingOnDelete makes DeleteRecords and BuildDeletePlan skip
+	// records that are not found instead of failing the whole batch, as
+	// the desired state, the record being gone, already holds. Skipped
+	// records are left out of the records returned, so comparing them to
+	// the input tells which were missing. Disabled by default.
+	IgnoreMissingOnDelete bool
+
+	// RollbackOnError makes AppendRecords and SetRecords undo what they
+	// changed if they fail part way, e.g. on the third record of a batch:
+	// created records are deleted, updated records restored and records
+	// SetRecords deleted with ReplaceRRsets created again, with new IDs.
+	// The rollback is best effort; if it fails as well, both errors are
+	// returned. Disabled by default, so the records written before the
+	// failure are kept and returned along with the error.
+	RollbackOnError bool
+
+	// VerifyWrites makes every record written be read back from regfish
+	// and compared to what was sent. If regfish stored different data or
+	// priority, e.g. because it normalized the input, the write fails with
+	// an error describing the difference; the record is left as regfish
+	// stored it. A different TTL is handled as TTLMismatch says. Disabled
+	// by default.
+	VerifyWrites bool
+
+	// TTLMismatch says how VerifyWrites treats a TTL regfish stored
+	// differently than it was sent, e.g. rounded to a supported step.
+	// Defaults to MismatchIgnore.
+	TTLMismatch MismatchPolicy
+
+	// CreateMismatch says how to treat a record regfish reports as created
+	// that lacks an ID or differs in name or type from the one requested,
+	// which would otherwise be a silent substitution. Unlike VerifyWrites,
+	// it only checks the response to the create request and makes no
+	// further request. Defaults to MismatchIgnore.
+	CreateMismatch MismatchPolicy
+
+	// Logger receives warnings, such as those of MismatchWarn. Defaults
+	// to the standard logger.
+	Logger Logger
+
+	// WriteTimeout limits how long a single call of AppendRecords,
+	// SetRecords, DeleteRecords or another writing method may take,
+	// including the reads it makes along the way, independent of
+	// ReadTimeout. As with ReadTimeout, an earlier deadline of the context
+	// passed in still applies. Zero means no limit besides the context.
+	WriteTimeout time.Duration
+
+	// Clock is used to tell the time and wait, e.g. between retries.
+	// Defaults to the system clock; tests may substitute a fake.
+	Clock Clock
+
+	client           rfns.Client
+	once             sync.Once
+	zoneMutexes      map[string]*sync.RWMutex
+	zoneMutexesMutex sync.Mutex
+	requests         chan struct{}
+
+	cache            map[string]cacheEntry
+	cacheGenerations map[string]uint64
+	cacheMutex       sync.Mutex
 }
 
 // GetRecords lists all the records in the zone.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	p.init(ctx)
+	records, _, err := p.GetRecordsWithCacheStatus(ctx, zone)
+	return records, err
+}
+
+// GetRecordsWithCacheStatus lists all the records in the zone like
+// GetRecords and additionally reports whether they were served from the
+// cache enabled by CacheTTL, and thus may be stale.
+func (p *Provider) GetRecordsWithCacheStatus(ctx context.Context, zone string) ([]libdns.Record, bool, error) {
+	ctx, cancel := withTimeout(ctx, p.ReadTimeout)
+	defer cancel()
+
+	if !p.UnlockedReads {
+		unlock, err := p.rlock(ctx, zone)
+		if err != nil {
+			return nil, false, err
+		}
+		defer unlock()
+	}
+	if err := p.init(ctx); err != nil {
+		return nil, false, err
+	}
 
-	records, err := p.client.GetRecordsByDomain(zone)
+	zone, _, err := p.toAPI(zone, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+		return nil, false, err
+	}
+
+	records, cached := p.cachedRecords(ctx, zone)
+	if !cached {
+		generation := p.cacheGeneration(zone)
+		records, err = p.getRecords(ctx, zone)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+		}
+		p.cacheRecords(zone, records, generation)
 	}
 
 	var libdnsRecords []libdns.Record
 	for _, rec := range records {
-		libdnsRecords = append(libdnsRecords, libdns.Record{
-			ID:       fmt.Sprintf("%d", rec.ID),
-			Type:     rec.Type,
-			Name:     libdns.RelativeName(rec.Name[:len(rec.Name)-1], zone),
-			Value:    rec.Data,
-			TTL:      time.Duration(rec.TTL) * time.Second,
-			Priority: getPriority(rec.Priority),
-		})
+		libdnsRecords = append(libdnsRecords, convertToLibdnsRecord(rec, zone))
+	}
+	libdnsRecords = p.fromAPI(libdnsRecords)
+
+	if p.SortRecords {
+		sortRecords(libdnsRecords)
+	}
+
+	return libdnsRecords, cached, nil
+}
+
+// GetRecordsDetailed lists all the records in the zone like GetRecords,
+// each together with the regfish record it was converted from, including
+// the annotation, tag and flags fields and, in Extra, any further fields
+// such as timestamps the regfish API returned. The records are always
+// fetched from the regfish API, bypassing the cache, and returned in the
+// order the regfish API lists them.
+func (p *Provider) GetRecordsDetailed(ctx context.Context, zone string) ([]RecordDetail, error) {
+	ctx, cancel := withTimeout(ctx, p.ReadTimeout)
+	defer cancel()
+
+	if !p.UnlockedReads {
+		unlock, err := p.rlock(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	zone, _, err := p.toAPI(zone, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := p.getRecordDetails(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+	for i := range details {
+		details[i].Record = p.fromAPI([]libdns.Record{details[i].Record})[0]
+	}
+	return details, nil
+}
+
+// GetRecordsMap lists all the records in the zone, grouped by name and type.
+// The map is keyed by "name|TYPE", where name is relative to the zone and
+// lowercased, for example "www|A" or "|MX" for the zone apex. The records
+// themselves keep the casing regfish returned.
+func (p *Provider) GetRecordsMap(ctx context.Context, zone string) (map[string][]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	recordsMap := make(map[string][]libdns.Record)
+	for _, rec := range records {
+		key := recordKey(rec.Name, rec.Type)
+		recordsMap[key] = append(recordsMap[key], rec)
+	}
+
+	return recordsMap, nil
+}
+
+// GetRecordsByNameAndType lists the records of the given name and type in
+// the zone, such as the A records of "www", or of all types at the name if
+// recordType is empty. The name is relative to the zone, with "" or "@"
+// for the apex, and like the type matched case-insensitively.
+//
+// The regfish API cannot filter records, so the whole zone is read and
+// filtered; with CacheTTL set, repeated lookups, such as those of an ACME
+// client polling its challenge record, are served from the cache.
+func (p *Provider) GetRecordsByNameAndType(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []libdns.Record
+	for _, rec := range records {
+		if sameName(rec.Name, name, zone) && (recordType == "" || strings.EqualFold(rec.Type, recordType)) {
+			matches = append(matches, rec)
+		}
 	}
 
-	return libdnsRecords, nil
+	return matches, nil
 }
 
 // AppendRecords adds records to the zone. It returns the records that were added.
+// If adding fails part way, e.g. because ctx is canceled, the records added
+// so far are returned along with the error. With RollbackOnError set, they
+// are deleted again instead.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	p.init(ctx)
+	zone, records, err := p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	createdRecs, err := p.appendRecords(ctx, zone, records)
 
 	var createdRecords []libdns.Record
-	for _, record := range records {
+	for _, createdRec := range createdRecs {
+		createdRecords = append(createdRecords, convertToLibdnsRecord(createdRec, zone))
+	}
+
+	return p.fromAPI(createdRecords), err
+}
+
+// AppendRecordsDetailed adds records to the zone like AppendRecords, but
+// returns the added records together with all fields regfish returned for
+// them, such as annotations, which libdns.Record cannot hold. This saves
+// stateful callers a follow-up read.
+func (p *Provider) AppendRecordsDetailed(ctx context.Context, zone string, records []libdns.Record) ([]RecordDetail, error) {
+	zone, records, err := p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	createdRecs, err := p.appendRecords(ctx, zone, records)
 
-		rec := rfns.Record{
-			Name:     p.fqdn(record.Name, zone),
-			Type:     record.Type,
-			Data:     record.Value,
-			TTL:      int(record.TTL.Seconds()),
-			Priority: &record.Priority,
+	var details []RecordDetail
+	for _, createdRec := range createdRecs {
+		detail := newRecordDetail(createdRec, zone)
+		detail.Name = p.fromAPIName(detail.Name)
+		details = append(details, detail)
+	}
+
+	return details, err
+}
+
+// appendRecords adds records to the zone and returns them as created by
+// regfish. If it fails part way, e.g. because ctx is canceled, it returns
+// the records created so far along with the error, or with RollbackOnError
+// deletes them again.
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record) (createdRecs []rfns.Record, err error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+	defer p.invalidateCache(zone)
+
+	if err := p.checkRecords(records); err != nil {
+		return nil, err
+	}
+	if p.MaxRecordsPerName > 0 {
+		existing, err := p.getRecords(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+		}
+		if err := p.checkRecordsPerName(existing, records, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := newChangeLog(nil)
+	if p.RollbackOnError && !p.dryRun(ctx) {
+		defer func() {
+			if err == nil {
+				return
+			}
+			if rerr := p.rollback(ctx, changes); rerr != nil {
+				err = rollbackError(err, rerr)
+				return
+			}
+			createdRecs = nil
+		}()
+	}
+
+	for i, record := range records {
+		if i > 0 && p.AppendWaveSize > 0 && i%p.AppendWaveSize == 0 {
+			p.reportAppendProgress(i, len(records))
+			if err := p.waitForWave(ctx); err != nil {
+				return createdRecs, fmt.Errorf("failed to create record %s: %w", record.Name, err)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return createdRecs, fmt.Errorf("failed to create record %s: %w", record.Name, err)
 		}
 
-		createdRec, err := p.client.CreateRecord(rec)
+		createdRec, err := p.createRecord(ctx, convertFromLibdnsRecord(record, zone))
+		changes.wrote(createdRec)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create record %s: %w", record.Name, err)
+			return createdRecs, fmt.Errorf("failed to create record %s: %w", record.Name, err)
 		}
 
-		createdRecords = append(createdRecords, libdns.Record{
-			ID:       fmt.Sprintf("%d", createdRec.ID),
-			Type:     createdRec.Type,
-			Name:     libdns.RelativeName(createdRec.Name, zone),
-			Value:    createdRec.Data,
-			TTL:      time.Duration(createdRec.TTL) * time.Second,
-			Priority: getPriority(createdRec.Priority),
-		})
+		createdRecs = append(createdRecs, createdRec)
 	}
+	p.reportAppendProgress(len(records), len(records))
 
-	return createdRecords, nil
+	return createdRecs, nil
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
 // It returns the updated records.
+//
+// A record with an ID updates the record with that ID. Otherwise, it
+// updates the record of the same name and type that holds its data and,
+// for MX, SRV and similar records, its priority, or the only record of the
+// same name and type. Records that other records of the batch hold
+// already or were written to are not picked, so that setting several
+// records of a name and type, such as round-robin A records, adds those
+// that are missing instead of overwriting each other. If several records
+// of the name and type could still be meant, such as round-robin A
+// records none of which holds the new address, it fails with
+// ErrAmbiguousRecord; set the ID to pick the one to update.
+//
+// The zone is read once before writing, and read again only if it changed
+// concurrently. Once all records are written, the zone is read back once
+// more, and the records are returned as regfish holds them then; if that
+// read fails, they are returned as regfish answered the writes.
+//
+// With ReplaceRRsets set, SetRecords instead makes the record sets of the
+// names and types of records hold exactly records, deleting the records
+// of those names and types that were not given. Record sets of other
+// names and types are left alone.
+//
+// If SetRecords fails part way, the records set so far are returned along
+// with the error. With RollbackOnError set, the changes are undone instead.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	p.init(ctx)
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
 
-	var updatedRecords []libdns.Record
+	zone, records, err = p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+	changed := !p.SkipUnchanged
+	defer func() {
+		if changed {
+			p.invalidateCache(zone)
+		}
+	}()
 
-	for _, record := range records {
-		// Map libdns.Record to rfns.Record
+	if err := p.checkRecords(records); err != nil {
+		return nil, err
+	}
 
-		// Attempt to update the record using the client
-		updateRec, err := p.upsertRecord(record, zone)
+	var existing []rfns.Record
+	cached := false
+	if p.SkipUnchanged {
+		existing, cached = p.cachedRecords(ctx, zone)
+	}
+	if !cached {
+		generation := p.cacheGeneration(zone)
+		existing, err = p.getRecordsForUpsert(ctx, zone)
 		if err != nil {
-			return nil, fmt.Errorf("failed to update record %s: %w", record.Name, err)
+			return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+		}
+		if p.SkipUnchanged {
+			p.cacheRecords(zone, existing, generation)
+		}
+	}
+	if !p.ReplaceRRsets {
+		if err := p.checkRecordsPerName(existing, plannedCreates(existing, records, zone), zone); err != nil {
+			return nil, err
+		}
+	}
+	index := newRecordIndex(existing, zone)
+	index.claim(records)
+	changes := newChangeLog(existing)
+
+	var updatedRecords []rfns.Record
+	written := false
+
+	if p.ReplaceRRsets {
+		updatedRecords, written, err = p.replaceRRsets(ctx, index, changes, records, zone)
+		if written {
+			changed = true
+		}
+	} else {
+		for _, record := range records {
+			if rec, ok := unchangedRecord(index, record, zone); ok {
+				updatedRecords = append(updatedRecords, rec)
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				err = fmt.Errorf("failed to update record %s: %w", record.Name, err)
+				break
+			}
+			changed = true
+			written = true
+
+			// Attempt to update the record using the client
+			var updateRec *rfns.Record
+			updateRec, err = p.upsertRecord(ctx, index, record, zone)
+			if updateRec != nil {
+				changes.wrote(*updateRec)
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to update record %s: %w", record.Name, err)
+				break
+			}
+			updatedRecords = append(updatedRecords, *updateRec)
+		}
+	}
+	if err != nil {
+		if p.RollbackOnError && !p.dryRun(ctx) {
+			if rerr := p.rollback(ctx, changes); rerr != nil {
+				return p.toLibdnsRecords(updatedRecords, zone), rollbackError(err, rerr)
+			}
+			return nil, err
 		}
+		return p.toLibdnsRecords(updatedRecords, zone), err
+	}
+
+	if written && !p.dryRun(ctx) {
+		// All records were written, so failing to read them back is no
+		// reason to fail; they are returned as written instead.
+		if final, err := p.getRecords(ctx, zone); err != nil {
+			p.logger().Printf("regfish: failed to read back records for zone %s, returning them as written: %v", zone, err)
+		} else {
+			updatedRecords = readBack(final, updatedRecords)
+		}
+	}
+
+	return p.toLibdnsRecords(updatedRecords, zone), nil
+}
 
-		// Map updated rfns.Record to libdns.Record and append to the result slice
-		updatedRecords = append(updatedRecords, libdns.Record{
-			ID:       fmt.Sprintf("%d", updateRec.ID),
-			Type:     updateRec.Type,
-			Name:     libdns.RelativeName(updateRec.Name, zone),
-			Value:    updateRec.Data,
-			TTL:      time.Duration(updateRec.TTL) * time.Second,
-			Priority: getPriority(updateRec.Priority),
-		})
+// toLibdnsRecords converts records of zone as the Provider returns them.
+func (p *Provider) toLibdnsRecords(records []rfns.Record, zone string) []libdns.Record {
+	var libdnsRecords []libdns.Record
+	for _, rec := range records {
+		libdnsRecords = append(libdnsRecords, convertToLibdnsRecord(rec, zone))
 	}
+	return p.fromAPI(libdnsRecords)
+}
 
-	return updatedRecords, nil
+// readBack returns records as they are found by ID among final, the
+// records of the zone read after writing them. Records missing from final,
+// e.g. because they were deleted concurrently, are returned as written.
+func readBack(final, records []rfns.Record) []rfns.Record {
+	byID := make(map[int]rfns.Record, len(final))
+	for _, rec := range final {
+		byID[rec.ID] = rec
+	}
+	result := make([]rfns.Record, 0, len(records))
+	for _, rec := range records {
+		if live, ok := byID[rec.ID]; ok && rec.ID != 0 {
+			rec = live
+		}
+		result = append(result, rec)
+	}
+	return result
 }
 
 // DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+// A record without ID and value deletes all records of its name and type,
+// which are returned as they were found; if there are none, that is no
+// error.
+// If deleting fails part way, e.g. because ctx is canceled, the records
+// deleted so far are returned along with the error.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	p.init(ctx)
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	zone, records, err = p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+	defer p.invalidateCache(zone)
 
-	all_records, err := p.client.GetRecordsByDomain(zone)
+	all_records, err := p.getRecords(ctx, zone)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
 	}
 
-	var rrid int
-	var deletedRecords []libdns.Record
+	deletedRecords, err := p.deleteRecords(ctx, zone, all_records, records)
+	return p.fromAPI(deletedRecords), err
+}
 
-	for _, record := range records {
+// DeleteRecordsFunc deletes the records of the zone for which match
+// returns true and returns them. match is given each record with all
+// fields regfish returned for it, so that, e.g., ACME challenge records
+// can be cleaned up by age using RecordDetail.Created, where available.
+// Names are given as GetRecords returns them. Protected records are
+// refused as by DeleteRecords.
+func (p *Provider) DeleteRecordsFunc(ctx context.Context, zone string, match func(RecordDetail) bool) ([]libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
 
-		// Find the record ID
-		rrid = 0
-		for _, rec := range all_records {
-			if fmt.Sprintf("%d", rec.ID) == record.ID || (p.fqdn(rec.Name, zone) == p.fqdn(record.Name, zone) && rec.Type == record.Type && rec.Data == record.Value) {
-				rrid = rec.ID
-				break
-			}
-		}
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	zone, _, err = p.toAPI(zone, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer p.invalidateCache(zone)
 
-		if rrid == 0 {
-			return nil, fmt.Errorf("record %s of type %s with data %s not found", record.Name, record.Type, record.Value)
+	details, err := p.getRecordDetails(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+
+	var all_records []rfns.Record
+	var records []libdns.Record
+	for _, detail := range details {
+		all_records = append(all_records, detail.Raw)
+		apiName := detail.Name
+		detail.Name = p.fromAPI([]libdns.Record{detail.Record})[0].Name
+		if match(detail) {
+			detail.Record.Name = apiName
+			records = append(records, detail.Record)
 		}
+	}
+
+	deletedRecords, err := p.deleteRecords(ctx, zone, all_records, records)
+	return p.fromAPI(deletedRecords), err
+}
+
+// DeleteRecordsWithSnapshot deletes the records from the zone like
+// DeleteRecords, but looks them up in snapshot, a list of the zone's records
+// as returned by GetRecords, instead of fetching the zone first. This saves
+// a request per call when tearing down a zone in several steps.
+//
+// The snapshot is not refreshed: records created since it was taken cannot
+// be found, and records deleted since, including by earlier calls with the
+// same snapshot, fail to delete with an error from the regfish API. A
+// snapshot record without a valid ID is an error, and nothing is deleted
+// then.
+func (p *Provider) DeleteRecordsWithSnapshot(ctx context.Context, zone string, snapshot, records []libdns.Record) ([]libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
 
-		err := p.client.DeleteRecord(rrid)
+	zone, records, err = p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+	_, snapshot, err = p.toAPI(zone, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer p.invalidateCache(zone)
+
+	all_records := make([]rfns.Record, 0, len(snapshot))
+	for _, record := range snapshot {
+		id, err := recordID(record)
 		if err != nil {
-			return nil, fmt.Errorf("failed to delete record ID %d: %w", rrid, err)
+			return nil, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("invalid snapshot: record %s of type %s has no ID", record.Name, record.Type)
 		}
-		deletedRecords = append(deletedRecords, record)
+		rec := convertFromLibdnsRecord(record, zone)
+		rec.ID = id
+		all_records = append(all_records, rec)
 	}
 
-	return deletedRecords, nil
+	deletedRecords, err := p.deleteRecords(ctx, zone, all_records, records)
+	return p.fromAPI(deletedRecords), err
 }
 
 // Interface guards
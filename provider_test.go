@@ -2,6 +2,10 @@ package regfish_test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/libdns/libdns"
 	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,7 +25,7 @@ var test_name = "libdns-test"
 func TestProviderFunction(t *testing.T) {
 	err := godotenv.Load(".env")
 	if err != nil {
-		panic("Cannot open .env file")
+		t.Skip("Cannot open .env file, skipping tests against the regfish API")
 	}
 
 	provider = regfish.Provider{
@@ -56,3 +61,1558 @@ func TestProviderFunction(t *testing.T) {
 		assert.NotNil(t, result)
 	})
 }
+
+func TestGetRecordsOrder(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "CNAME", Data: "example.com.", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+		rfns.Record{Name: "mail.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	names := func(records []libdns.Record) []string {
+		var out []string
+		for _, rec := range records {
+			out = append(out, rec.Name+" "+rec.Type)
+		}
+		return out
+	}
+
+	t.Run("API order by default", func(t *testing.T) {
+		result, err := api.provider().GetRecords(context.Background(), test_zone)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"www CNAME", " TXT", "mail A", " A"}, names(result))
+	})
+
+	t.Run("Sorted when SortRecords is set", func(t *testing.T) {
+		p := api.provider()
+		p.SortRecords = true
+		result, err := p.GetRecords(context.Background(), test_zone)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{" A", " TXT", "mail A", "www CNAME"}, names(result))
+	})
+}
+
+func TestGetRecordsConcurrent(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodPost {
+			close(started)
+			<-release
+		}
+	}
+
+	p := api.provider()
+	p.UnlockedReads = true
+
+	// Hold the write lock with a blocked AppendRecords call.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{{Name: "new", Type: "A", Value: "10.0.0.2"}})
+		assert.Nil(t, err)
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := p.GetRecords(context.Background(), test_zone)
+			assert.Nil(t, err)
+			assert.Len(t, result, 1)
+		}()
+	}
+
+	reads := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(reads)
+	}()
+
+	select {
+	case <-reads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetRecords blocked behind a running write")
+	}
+
+	close(release)
+	<-done
+}
+
+func TestGetRecordsMap(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+	)
+
+	result, err := api.provider().GetRecordsMap(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Len(t, result, 3)
+
+	if assert.Len(t, result["www|A"], 2) {
+		assert.Equal(t, "10.0.0.1", result["www|A"][0].Value)
+		assert.Equal(t, "10.0.0.2", result["www|A"][1].Value)
+	}
+	assert.Len(t, result["www|AAAA"], 1)
+	assert.Len(t, result["|TXT"], 1)
+}
+
+func TestMaxRecordsPerName(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "one", TTL: 300},
+		rfns.Record{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "two", TTL: 300},
+	)
+
+	p := api.provider()
+	p.MaxRecordsPerName = 3
+
+	t.Run("AppendRecords within the limit", func(t *testing.T) {
+		result, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+			{Name: "_acme-challenge", Type: "TXT", Value: "three"},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, result, 1)
+	})
+
+	t.Run("AppendRecords exceeding the limit", func(t *testing.T) {
+		result, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+			{Name: "other", Type: "TXT", Value: "unrelated"},
+			{Name: "_acme-challenge", Type: "TXT", Value: "four"},
+		})
+		assert.ErrorContains(t, err, "limit of 3 records per name")
+		assert.Nil(t, result)
+		assert.Len(t, api.snapshot(), 3)
+	})
+
+	t.Run("SetRecords replacing an existing record", func(t *testing.T) {
+		reads := api.count("GET /dns/example.com/rr")
+		result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+			{Name: "_acme-challenge", Type: "TXT", Value: "three", TTL: time.Hour},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, result, 1)
+		assert.Len(t, api.snapshot(), 3)
+		// The zone is read once before writing and once to read back.
+		assert.Equal(t, reads+2, api.count("GET /dns/example.com/rr"))
+	})
+
+	t.Run("UpsertRecords reading the zone once", func(t *testing.T) {
+		reads := api.count("GET /dns/example.com/rr")
+		_, err := p.UpsertRecords(context.Background(), test_zone, []libdns.Record{
+			{Name: "_acme-challenge", Type: "TXT", Value: "three", TTL: 2 * time.Hour},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, reads+1, api.count("GET /dns/example.com/rr"))
+	})
+}
+
+func TestMaxRecordsPerNameRoundRobin(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "10.0.0.3", TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "10.0.0.4", TTL: time.Hour},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		write func(p *regfish.Provider) ([]libdns.Record, error)
+	}{
+		{"SetRecords", func(p *regfish.Provider) ([]libdns.Record, error) {
+			return p.SetRecords(context.Background(), test_zone, records)
+		}},
+		{"SetRecords with ReplaceRRsets", func(p *regfish.Provider) ([]libdns.Record, error) {
+			p.ReplaceRRsets = true
+			return p.SetRecords(context.Background(), test_zone, records)
+		}},
+		{"UpsertRecords", func(p *regfish.Provider) ([]libdns.Record, error) {
+			return p.UpsertRecords(context.Background(), test_zone, records)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newMockAPI(t,
+				rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 3600},
+			)
+			p := api.provider()
+			p.MaxRecordsPerName = 1
+
+			result, err := tc.write(p)
+			assert.ErrorContains(t, err, "limit of 1 records per name")
+			assert.Nil(t, result)
+			if stored := api.snapshot(); assert.Len(t, stored, 1) {
+				assert.Equal(t, "10.0.0.1", stored[0].Data)
+			}
+
+			// Within the limit, the batch goes through.
+			p.MaxRecordsPerName = 3
+			_, err = tc.write(p)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestAppendRecordsOverQualifiedName(t *testing.T) {
+	api := newMockAPI(t)
+
+	result, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www.example.com", Type: "A", Value: "192.0.2.1", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "www", result[0].Name)
+	}
+	if records := api.snapshot(); assert.Len(t, records, 1) {
+		assert.Equal(t, "www.example.com.", records[0].Name)
+	}
+}
+
+func TestPriorityOnTXT(t *testing.T) {
+	records := []libdns.Record{{Name: "prio", Type: "TXT", Value: "hello", TTL: time.Minute, Priority: 10}}
+
+	t.Run("Ignored by default", func(t *testing.T) {
+		api := newMockAPI(t)
+		result, err := api.provider().AppendRecords(context.Background(), test_zone, records)
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, 0, result[0].Priority)
+		}
+		if stored := api.snapshot(); assert.Len(t, stored, 1) {
+			assert.Nil(t, stored[0].Priority)
+		}
+	})
+
+	t.Run("Rejected with StrictPriority", func(t *testing.T) {
+		api := newMockAPI(t)
+		p := api.provider()
+		p.StrictPriority = true
+
+		_, err := p.AppendRecords(context.Background(), test_zone, records)
+		assert.ErrorContains(t, err, "cannot have a priority")
+		_, err = p.SetRecords(context.Background(), test_zone, records)
+		assert.ErrorContains(t, err, "cannot have a priority")
+		assert.Empty(t, api.snapshot())
+	})
+}
+
+func TestDeleteRecordsWithSnapshot(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "b.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "c.example.com.", Type: "TXT", Data: "keep", TTL: 300},
+	)
+	p := api.provider()
+
+	snapshot, err := p.GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+
+	result, err := p.DeleteRecordsWithSnapshot(context.Background(), test_zone, snapshot, []libdns.Record{{Name: "a", Type: "A", Value: "10.0.0.1"}})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+
+	result, err = p.DeleteRecordsWithSnapshot(context.Background(), test_zone, snapshot, []libdns.Record{{Name: "b", Type: "A", Value: "10.0.0.2"}})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+	if remaining := api.snapshot(); assert.Len(t, remaining, 1) {
+		assert.Equal(t, "c.example.com.", remaining[0].Name)
+	}
+}
+
+func TestDeleteRecordsWithSnapshotInvalidID(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+
+	for _, id := range []string{"abc", ""} {
+		snapshot := []libdns.Record{{ID: id, Name: "a", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute}}
+		result, err := p.DeleteRecordsWithSnapshot(context.Background(), test_zone, snapshot, []libdns.Record{{Name: "a", Type: "A", Value: "10.0.0.1"}})
+		assert.ErrorContains(t, err, "invalid snapshot", "ID %q", id)
+		assert.Empty(t, result)
+	}
+	assert.Len(t, api.snapshot(), 1)
+}
+
+func TestServiceBindingPriority(t *testing.T) {
+	record := libdns.Record{Name: "", Type: "HTTPS", Value: ". alpn=h2,h3", TTL: time.Hour, Priority: 1}
+
+	t.Run("AppendRecords", func(t *testing.T) {
+		api := newMockAPI(t)
+		result, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{record})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, 1, result[0].Priority)
+		}
+		if stored := api.snapshot(); assert.Len(t, stored, 1) && assert.NotNil(t, stored[0].Priority) {
+			assert.Equal(t, 1, *stored[0].Priority)
+			assert.Equal(t, ". alpn=h2,h3", stored[0].Data)
+		}
+	})
+
+	t.Run("SetRecords", func(t *testing.T) {
+		api := newMockAPI(t)
+		result, err := api.provider().SetRecords(context.Background(), test_zone, []libdns.Record{record})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, 1, result[0].Priority)
+		}
+		if stored := api.snapshot(); assert.Len(t, stored, 1) && assert.NotNil(t, stored[0].Priority) {
+			assert.Equal(t, 1, *stored[0].Priority)
+			assert.Equal(t, ". alpn=h2,h3", stored[0].Data)
+		}
+	})
+}
+
+func TestAppendRecordsDetailed(t *testing.T) {
+	api := newMockAPI(t)
+	annotation := "created by automation"
+	flags := 1
+	api.onCreate = func(rec *rfns.Record) {
+		rec.Annotation = &annotation
+		rec.Flags = &flags
+	}
+
+	result, err := api.provider().AppendRecordsDetailed(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "www", result[0].Name)
+		assert.Equal(t, "10.0.0.1", result[0].Value)
+		assert.Equal(t, result[0].ID, fmt.Sprint(result[0].Raw.ID))
+		assert.Equal(t, "www.example.com.", result[0].Raw.Name)
+		if assert.NotNil(t, result[0].Raw.Annotation) {
+			assert.Equal(t, annotation, *result[0].Raw.Annotation)
+		}
+		if assert.NotNil(t, result[0].Raw.Flags) {
+			assert.Equal(t, 1, *result[0].Raw.Flags)
+		}
+	}
+}
+
+func TestSetRecordsConcurrentModification(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	// Another client deletes the record right before it is updated.
+	var once sync.Once
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodPatch {
+			once.Do(func() { api.remove(1) })
+		}
+	}
+
+	result, err := api.provider().SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "10.0.0.2", result[0].Value)
+	}
+	// the initial read, the read for the retry and the read-back
+	assert.Equal(t, 3, api.count("GET /dns/example.com/rr"))
+	if stored := api.snapshot(); assert.Len(t, stored, 1) {
+		assert.Equal(t, "10.0.0.2", stored[0].Data)
+	}
+}
+
+func TestSetRecordsConcurrentModificationGivesUp(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	// The record to update vanishes and reappears with every attempt.
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodPatch {
+			api.remove(1)
+		}
+		if r.Method == http.MethodGet {
+			api.mu.Lock()
+			if len(api.records) == 0 {
+				api.add(rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300})
+			}
+			api.mu.Unlock()
+		}
+	}
+
+	p := api.provider()
+	p.UpsertAttempts = 2
+	_, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, 2, api.count("PATCH /dns/rr/1"))
+}
+
+func TestNameCaseInsensitive(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "WWW.Example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "Mail.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+
+	t.Run("DeleteRecords", func(t *testing.T) {
+		result, err := p.DeleteRecords(context.Background(), test_zone, []libdns.Record{{Name: "www", Type: "a", Value: "10.0.0.1"}})
+		assert.Nil(t, err)
+		assert.Len(t, result, 1)
+	})
+
+	t.Run("SetRecords", func(t *testing.T) {
+		result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{{Name: "MAIL", Type: "A", Value: "10.0.0.3"}})
+		assert.Nil(t, err)
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, "2", result[0].ID)
+		}
+	})
+
+	t.Run("GetRecordsMap", func(t *testing.T) {
+		result, err := p.GetRecordsMap(context.Background(), test_zone)
+		assert.Nil(t, err)
+		if assert.Len(t, result["mail|A"], 1) {
+			assert.Equal(t, "MAIL", result["mail|A"][0].Name)
+		}
+	})
+}
+
+func TestRedactSensitive(t *testing.T) {
+	api := newMockAPI(t)
+	secret := libdns.Record{Name: "_acme-challenge", Type: "TXT", Value: "s3cr3t-token"}
+	plain := libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"}
+
+	p := api.provider()
+	_, err := p.DeleteRecords(context.Background(), test_zone, []libdns.Record{secret})
+	assert.ErrorContains(t, err, "s3cr3t-token")
+
+	p.RedactSensitive = true
+	_, err = p.DeleteRecords(context.Background(), test_zone, []libdns.Record{secret})
+	assert.ErrorContains(t, err, "[redacted, 12 bytes]")
+	assert.NotContains(t, err.Error(), "s3cr3t-token")
+
+	_, err = p.DeleteRecords(context.Background(), test_zone, []libdns.Record{plain})
+	assert.ErrorContains(t, err, "10.0.0.1")
+
+	_, err = p.RotateTXT(context.Background(), test_zone, "_acme-challenge", "s3cr3t-token", "new")
+	assert.NotContains(t, err.Error(), "s3cr3t-token")
+}
+
+// countingLimiter is a regfish.Limiter that counts waits and records the
+// number of records created before each wait.
+type countingLimiter struct {
+	api     *mockAPI
+	created []int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.created = append(l.created, len(l.api.snapshot()))
+	return ctx.Err()
+}
+
+func TestAppendRecordsWaves(t *testing.T) {
+	api := newMockAPI(t)
+	limiter := &countingLimiter{api: api}
+
+	var progress [][2]int
+	p := api.provider()
+	p.AppendWaveSize = 10
+	p.AppendWaveLimiter = limiter
+	p.AppendProgress = func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	}
+
+	var records []libdns.Record
+	for i := 0; i < 25; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "10.0.0.1"})
+	}
+
+	result, err := p.AppendRecords(context.Background(), test_zone, records)
+	assert.Nil(t, err)
+	assert.Len(t, result, 25)
+	assert.Equal(t, []int{10, 20}, limiter.created)
+	assert.Equal(t, [][2]int{{10, 25}, {20, 25}, {25, 25}}, progress)
+}
+
+func TestAppendRecordsWavesCanceled(t *testing.T) {
+	api := newMockAPI(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := api.provider()
+	p.AppendWaveSize = 2
+	p.AppendProgress = func(done, total int) { cancel() }
+
+	var records []libdns.Record
+	for i := 0; i < 5; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "10.0.0.1"})
+	}
+
+	start := time.Now()
+	_, err := p.AppendRecords(ctx, test_zone, records)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, api.snapshot(), 2)
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	// Requests wait until the limit is reached, so that it is known to be
+	// reached, and then stay in flight a while, so that exceeding it shows.
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	full := make(chan struct{})
+	api.before = func(r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+			if maxInFlight == 2 {
+				close(full)
+			}
+		}
+		mu.Unlock()
+
+		select {
+		case <-full:
+		case <-time.After(time.Second):
+			t.Error("limit of concurrent requests not reached")
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+
+	p := api.provider()
+	p.UnlockedReads = true
+	p.MaxConcurrentRequests = 2
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.GetRecords(context.Background(), test_zone)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxInFlight, 2)
+	assert.Equal(t, 10, api.count("GET /dns/example.com/rr"))
+}
+
+func TestApexMarkers(t *testing.T) {
+	for _, apex := range []string{"", "@"} {
+		t.Run(fmt.Sprintf("%q", apex), func(t *testing.T) {
+			api := newMockAPI(t)
+			result, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+				{Name: apex, Type: "MX", Value: "mx.example.net.", TTL: time.Hour, Priority: 10},
+				{Name: apex, Type: "TXT", Value: "v=spf1 -all", TTL: time.Hour},
+			})
+			assert.Nil(t, err)
+			if assert.Len(t, result, 2) {
+				assert.Equal(t, "", result[0].Name)
+				assert.Equal(t, "", result[1].Name)
+			}
+			for _, rec := range api.snapshot() {
+				assert.Equal(t, "example.com.", rec.Name)
+			}
+
+			deleted, err := api.provider().DeleteRecords(context.Background(), test_zone, []libdns.Record{
+				{Name: apex, Type: "TXT", Value: "v=spf1 -all"},
+			})
+			assert.Nil(t, err)
+			assert.Len(t, deleted, 1)
+		})
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	api.before = func(r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	p := api.provider()
+	p.ReadTimeout = 10 * time.Millisecond
+
+	start := time.Now()
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// The read timeout does not apply to writes, including their reads.
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+
+	p.WriteTimeout = 10 * time.Millisecond
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReadTimeoutContextDeadline(t *testing.T) {
+	api := newMockAPI(t)
+	api.before = func(r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	p := api.provider()
+	p.ReadTimeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.GetRecords(ctx, test_zone)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestVerifyWrites(t *testing.T) {
+	api := newMockAPI(t)
+	api.onCreate = func(rec *rfns.Record) {
+		if rec.Type == "AAAA" {
+			rec.Data = "2001:db8::2"
+		}
+	}
+
+	p := api.provider()
+	p.VerifyWrites = true
+
+	_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, api.count("GET /dns/rr/1001"))
+
+	_, err = p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "AAAA", Value: "2001:0db8:0000::1", TTL: time.Hour},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "stored with data 2001:db8::2 instead of 2001:db8::1")
+	}
+}
+
+func TestSetRecordsByID(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.3", TTL: 300},
+	)
+	p := api.provider()
+
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{ID: "1002", Name: "www", Type: "A", Value: "10.0.0.22", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1002", result[0].ID)
+	}
+
+	stored := api.snapshot()
+	assert.Equal(t, "10.0.0.1", stored[0].Data)
+	assert.Equal(t, "10.0.0.22", stored[1].Data)
+	assert.Equal(t, "10.0.0.3", stored[2].Data)
+
+	// Without an ID, the record holding the same data is updated.
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.3", TTL: 10 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 600, api.snapshot()[2].TTL)
+
+	// Without an ID and matching data, it is unclear which to update.
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.11", TTL: 5 * time.Minute},
+	})
+	assert.ErrorIs(t, err, regfish.ErrAmbiguousRecord)
+	assert.ErrorContains(t, err, "www of type A matches 3 records")
+	assert.Equal(t, stored[0], api.snapshot()[0])
+}
+
+func TestGetRecordsByNameAndType(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "WWW.example.com.", Type: "A", Data: "10.0.0.3", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		rfns.Record{Name: "www.sub.example.com.", Type: "A", Data: "10.0.0.4", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	values := func(records []libdns.Record) []string {
+		var values []string
+		for _, rec := range records {
+			values = append(values, rec.Value)
+		}
+		return values
+	}
+
+	for _, apex := range []string{"", "@"} {
+		records, err := p.GetRecordsByNameAndType(ctx, test_zone, apex, "a")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, values(records))
+	}
+
+	records, err := p.GetRecordsByNameAndType(ctx, test_zone, "www", "A")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, values(records))
+
+	records, err = p.GetRecordsByNameAndType(ctx, test_zone, "www.sub", "A")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.4"}, values(records))
+
+	records, err = p.GetRecordsByNameAndType(ctx, test_zone, "ftp", "A")
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	records, err = p.GetRecordsByNameAndType(ctx, test_zone, "www", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3", "2001:db8::1"}, values(records))
+
+	p.CacheTTL = time.Minute
+	for i := 0; i < 3; i++ {
+		_, err = p.GetRecordsByNameAndType(ctx, test_zone, "www", "A")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 7, api.count("GET /dns/example.com/rr"))
+}
+
+// logRecorder is a regfish.Logger recording what is logged.
+type logRecorder struct {
+	lines []string
+}
+
+func (l *logRecorder) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestVerifyWritesTTLMismatch(t *testing.T) {
+	tests := []struct {
+		policy regfish.MismatchPolicy
+		fail   bool
+		warn   bool
+	}{
+		{regfish.MismatchError, true, false},
+		{regfish.MismatchWarn, false, true},
+		{regfish.MismatchIgnore, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			api := newMockAPI(t)
+			api.onCreate = func(rec *rfns.Record) {
+				rec.TTL = (rec.TTL + 59) / 60 * 60
+			}
+
+			logs := &logRecorder{}
+			p := api.provider()
+			p.VerifyWrites = true
+			p.TTLMismatch = tt.policy
+			p.Logger = logs
+
+			_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+				{Name: "www", Type: "A", Value: "10.0.0.1", TTL: 90 * time.Second},
+			})
+			if tt.fail {
+				assert.ErrorContains(t, err, "stored with TTL 120 instead of 90")
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.warn {
+				if assert.Len(t, logs.lines, 1) {
+					assert.Contains(t, logs.lines[0], "stored with TTL 120 instead of 90")
+				}
+			} else {
+				assert.Empty(t, logs.lines)
+			}
+		})
+	}
+}
+
+func TestCancelMidBatch(t *testing.T) {
+	var records []libdns.Record
+	for i := 0; i < 10; i++ {
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "10.0.0.1", TTL: time.Minute})
+	}
+
+	t.Run("AppendRecords", func(t *testing.T) {
+		api := newMockAPI(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := api.provider()
+		p.Clock = newFakeClock()
+		p.AppendWaveSize = 1
+		p.AppendProgress = func(done, total int) {
+			if done == 2 {
+				cancel()
+			}
+		}
+
+		result, err := p.AppendRecords(ctx, test_zone, records)
+		assert.ErrorIs(t, err, context.Canceled)
+		if assert.Len(t, result, 2) {
+			assert.Equal(t, "host1", result[1].Name)
+		}
+		assert.Len(t, api.snapshot(), 2)
+	})
+
+	t.Run("DeleteRecords", func(t *testing.T) {
+		api := newMockAPI(t)
+		for _, record := range records {
+			api.add(regfish.FromLibdnsRecord(record, test_zone))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The third delete cancels ctx and is refused, so that exactly two
+		// records are deleted however the client notices the cancellation.
+		deletes := 0
+		api.fail = func(r *http.Request) (int, string) {
+			if r.Method != http.MethodDelete {
+				return 0, ""
+			}
+			deletes++
+			if deletes < 3 {
+				return 0, ""
+			}
+			cancel()
+			return http.StatusServiceUnavailable, `{"error": "unavailable"}`
+		}
+
+		p := api.provider()
+		p.Clock = newFakeClock()
+
+		result, err := p.DeleteRecords(ctx, test_zone, records)
+		assert.ErrorIs(t, err, context.Canceled)
+		if assert.Len(t, result, 2) {
+			assert.Equal(t, "host0", result[0].Name)
+			assert.Equal(t, "host1", result[1].Name)
+		}
+
+		var left []string
+		for _, rec := range api.snapshot() {
+			left = append(left, rec.Name)
+		}
+		assert.Equal(t, []string{
+			"host2.example.com.", "host3.example.com.", "host4.example.com.", "host5.example.com.",
+			"host6.example.com.", "host7.example.com.", "host8.example.com.", "host9.example.com.",
+		}, left)
+	})
+}
+
+func TestDeleteRecordsFuncByAge(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "old", TTL: 60},
+		rfns.Record{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "new", TTL: 60},
+		rfns.Record{Name: "_acme-challenge.www.example.com.", Type: "TXT", Data: "unknown", TTL: 60},
+	)
+	now := time.Now().UTC()
+	api.response = func(r *http.Request) string {
+		if r.Method != http.MethodGet {
+			return ""
+		}
+		return fmt.Sprintf(`{"response": [
+			{"id": 1001, "name": "_acme-challenge.example.com.", "type": "TXT", "data": "old", "ttl": 60, "created_at": %q},
+			{"id": 1002, "name": "_acme-challenge.example.com.", "type": "TXT", "data": "new", "ttl": 60, "created_at": %d},
+			{"id": 1003, "name": "_acme-challenge.www.example.com.", "type": "TXT", "data": "unknown", "ttl": 60}
+		]}`, now.Add(-2*time.Hour).Format(time.RFC3339), now.Add(-time.Minute).Unix())
+	}
+
+	deleted, err := api.provider().DeleteRecordsFunc(context.Background(), test_zone, func(rec regfish.RecordDetail) bool {
+		created, ok := rec.Created()
+		return ok && time.Since(created) > time.Hour
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1001", Name: "_acme-challenge", Type: "TXT", Value: "old", TTL: time.Minute},
+	}, deleted)
+
+	stored := api.snapshot()
+	if assert.Len(t, stored, 2) {
+		assert.Equal(t, 1002, stored[0].ID)
+		assert.Equal(t, 1003, stored[1].ID)
+	}
+}
+
+func TestDeleteRecordsFuncApexAt(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+	)
+	p := api.provider()
+	p.ApexAt = true
+
+	var names []string
+	deleted, err := p.DeleteRecordsFunc(context.Background(), test_zone, func(rec regfish.RecordDetail) bool {
+		names = append(names, rec.Name)
+		return rec.Name == "@"
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"@", "www"}, names)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1001", Name: "@", Type: "TXT", Value: "v=spf1 -all", TTL: 5 * time.Minute},
+	}, deleted)
+	assert.Len(t, api.snapshot(), 1)
+}
+
+func TestCreateMismatch(t *testing.T) {
+	for _, policy := range []regfish.MismatchPolicy{regfish.MismatchIgnore, regfish.MismatchWarn, regfish.MismatchError} {
+		t.Run(policy.String(), func(t *testing.T) {
+			api := newMockAPI(t)
+			api.onCreate = func(rec *rfns.Record) {
+				rec.Name = "other.example.com."
+			}
+
+			logs := &logRecorder{}
+			p := api.provider()
+			p.CreateMismatch = policy
+			p.Logger = logs
+
+			_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+				{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+			})
+			if policy == regfish.MismatchError {
+				assert.ErrorContains(t, err, "created record ID 1001 as other.example.com. of type A instead of www.example.com. of type A")
+			} else {
+				assert.Nil(t, err)
+			}
+			if policy == regfish.MismatchWarn {
+				assert.Len(t, logs.lines, 1)
+			} else {
+				assert.Empty(t, logs.lines)
+			}
+		})
+	}
+}
+
+func TestMismatchPolicyDefault(t *testing.T) {
+	var p regfish.Provider
+	assert.Equal(t, regfish.MismatchIgnore, p.TTLMismatch)
+	assert.Equal(t, regfish.MismatchIgnore, p.CreateMismatch)
+}
+
+func TestCreateMismatchMatching(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.CreateMismatch = regfish.MismatchError
+
+	_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "WWW", Type: "a", Value: "10.0.0.1", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+}
+
+func TestRefetchEmptyZone(t *testing.T) {
+	for _, refetch := range []bool{false, true} {
+		t.Run(fmt.Sprint(refetch), func(t *testing.T) {
+			api := newMockAPI(t,
+				rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+			)
+			reads := 0
+			api.fail = func(r *http.Request) (int, string) {
+				if r.Method == http.MethodGet {
+					reads++
+					if reads == 1 {
+						return http.StatusOK, `{"response": []}`
+					}
+				}
+				return 0, ""
+			}
+
+			p := api.provider()
+			p.RefetchEmptyZone = refetch
+			_, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+				{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+			})
+			assert.Nil(t, err)
+
+			if refetch {
+				assert.Len(t, api.snapshot(), 1)
+				assert.Equal(t, 1, api.count("PATCH /dns/rr/1001"))
+			} else {
+				assert.Len(t, api.snapshot(), 2, "expected the transient empty read to cause a duplicate")
+			}
+		})
+	}
+}
+
+func TestApexAt(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "a.b.c.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	records, err := p.GetRecords(ctx, "example.com.")
+	assert.Nil(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "", records[0].Name)
+		assert.Equal(t, "a.b.c", records[1].Name)
+	}
+
+	p.ApexAt = true
+	records, err = p.GetRecords(ctx, "example.com.")
+	assert.Nil(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "@", records[0].Name)
+		assert.Equal(t, "a.b.c", records[1].Name)
+	}
+
+	records, err = p.SetRecords(ctx, "example.com.", []libdns.Record{{Name: "@", Type: "A", Value: "10.0.0.3", TTL: time.Minute}})
+	assert.Nil(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "@", records[0].Name)
+	}
+	assert.Equal(t, "example.com.", api.snapshot()[0].Name)
+	assert.Equal(t, "10.0.0.3", api.snapshot()[0].Data)
+}
+
+func TestMissingToken(t *testing.T) {
+	api := newMockAPI(t, rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300})
+	p := api.provider()
+	p.APIToken = ""
+	ctx := context.Background()
+
+	_, err := p.GetRecords(ctx, "example.com.")
+	assert.ErrorIs(t, err, regfish.ErrMissingToken)
+	assert.EqualError(t, err, "regfish: APIToken is empty")
+
+	_, err = p.AppendRecords(ctx, "example.com.", []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2"}})
+	assert.ErrorIs(t, err, regfish.ErrMissingToken)
+
+	assert.Equal(t, 0, api.count("GET /dns/example.com./rr"))
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+}
+
+func TestInvalidToken(t *testing.T) {
+	api := newMockAPI(t)
+	ctx := context.Background()
+
+	for _, token := range []string{"test-token\n", " test-token", "test token", "tést-token"} {
+		p := api.provider()
+		p.APIToken = token
+		_, err := p.GetRecords(ctx, test_zone)
+		assert.ErrorIs(t, err, regfish.ErrInvalidToken, "token %q", token)
+	}
+	assert.Equal(t, 0, api.count("GET /dns/example.com/rr"))
+
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusUnauthorized, `{"message": "invalid api key"}`
+	}
+	_, err := api.provider().GetRecords(ctx, test_zone)
+	assert.ErrorIs(t, err, regfish.ErrUnauthorized)
+	assert.NotErrorIs(t, err, regfish.ErrServiceUnavailable)
+}
+
+func TestGetRecordsDetailed(t *testing.T) {
+	api := newMockAPI(t)
+	api.response = func(r *http.Request) string {
+		return `{"response": [
+			{"id": 1001, "name": "example.com.", "type": "MX", "data": "mx.example.net.", "ttl": 3600, "priority": 10, "annotation": "mail", "status": "active", "created_at": "2024-05-01T12:00:00Z"},
+			{"id": 1002, "name": "www.example.com.", "type": "A", "data": "10.0.0.1", "ttl": 300}
+		]}`
+	}
+
+	details, err := api.provider().GetRecordsDetailed(context.Background(), test_zone)
+	assert.Nil(t, err)
+	if !assert.Len(t, details, 2) {
+		return
+	}
+
+	assert.Equal(t, libdns.Record{ID: "1001", Type: "MX", Name: "", Value: "mx.example.net.", TTL: time.Hour, Priority: 10}, details[0].Record)
+	assert.Equal(t, 1001, details[0].Raw.ID)
+	assert.Equal(t, "example.com.", details[0].Raw.Name)
+	if assert.NotNil(t, details[0].Raw.Annotation) {
+		assert.Equal(t, "mail", *details[0].Raw.Annotation)
+	}
+	assert.JSONEq(t, `"active"`, string(details[0].Extra["status"]))
+	created, ok := details[0].Created()
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), created)
+
+	assert.Equal(t, "www", details[1].Name)
+	assert.Equal(t, "10.0.0.1", details[1].Raw.Data)
+	assert.Nil(t, details[1].Extra)
+	for _, detail := range details {
+		assert.Equal(t, regfish.ToLibdnsRecord(detail.Raw, test_zone), detail.Record)
+	}
+}
+
+func TestSetRecordsReadBack(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "example.com.", Type: "MX", Data: "mx.example.net.", TTL: 300, Priority: intPtr(10)},
+	)
+	// regfish raises TTLs below its minimum when storing records, which
+	// the write responses do not reflect.
+	api.before = func(r *http.Request) {
+		if r.Method != http.MethodGet {
+			return
+		}
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		for i := range api.records {
+			if api.records[i].TTL < 120 {
+				api.records[i].TTL = 120
+			}
+		}
+	}
+	p := api.provider()
+	ctx := context.Background()
+
+	result, err := p.SetRecords(ctx, test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+		{Name: "", Type: "MX", Value: "mx2.example.net.", TTL: time.Minute, Priority: 20},
+		{Name: "api", Type: "A", Value: "10.0.0.3", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, api.count("GET /dns/example.com/rr"))
+
+	all, err := p.GetRecords(ctx, test_zone)
+	assert.Nil(t, err)
+	if assert.Len(t, result, 3) {
+		for _, rec := range result {
+			assert.Contains(t, all, rec)
+			assert.Equal(t, 2*time.Minute, rec.TTL)
+		}
+	}
+}
+
+func TestSetRecordsReadBackFails(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	gets := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method != http.MethodGet {
+			return 0, ""
+		}
+		if gets++; gets > 1 {
+			return http.StatusServiceUnavailable, `{"message": "maintenance"}`
+		}
+		return 0, ""
+	}
+	logs := &logRecorder{}
+	p := api.provider()
+	p.Logger = logs
+	p.Clock = newFakeClock()
+
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+		{Name: "api", Type: "A", Value: "10.0.0.3", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, libdns.Record{ID: "1", Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute}, result[0])
+		assert.Equal(t, "10.0.0.3", result[1].Value)
+	}
+	if assert.Len(t, logs.lines, 1) {
+		assert.Contains(t, logs.lines[0], "failed to read back records")
+	}
+}
+
+func TestSetRecordsSingleFetch(t *testing.T) {
+	api := newMockAPI(t)
+	for i := 0; i < 20; i++ {
+		api.add(rfns.Record{Name: fmt.Sprintf("host%d.example.com.", i), Type: "A", Data: "10.0.0.1", TTL: 300})
+	}
+	p := api.provider()
+	ctx := context.Background()
+
+	var records []libdns.Record
+	for i := 0; i < 40; i++ {
+		// half of the records exist, given with varying case and
+		// qualification, the other half is created
+		name := fmt.Sprintf("host%d", i)
+		if i%2 == 1 {
+			name = strings.ToUpper(name) + ".Example.COM."
+		}
+		records = append(records, libdns.Record{Name: name, Type: "A", Value: "10.0.0.2", TTL: time.Minute})
+	}
+
+	result, err := p.SetRecords(ctx, test_zone, records)
+	assert.Nil(t, err)
+	assert.Len(t, result, 40)
+	// the initial read and the read-back, regardless of the batch size
+	assert.Equal(t, 2, api.count("GET /dns/example.com/rr"))
+	assert.Len(t, api.snapshot(), 40)
+
+	// DeleteRecords matches the records SetRecords wrote the same way.
+	deleted, err := p.DeleteRecords(ctx, test_zone, records)
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 40)
+	assert.Empty(t, api.snapshot())
+}
+
+func TestSRVPriority(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	ctx := context.Background()
+	srv := libdns.Record{Name: "_sip._udp", Type: "SRV", Value: "5 5060 sip.example.com.", TTL: time.Hour, Priority: 10}
+
+	appended, err := p.AppendRecords(ctx, test_zone, []libdns.Record{srv})
+	assert.Nil(t, err)
+	set, err := p.SetRecords(ctx, "other.example.", []libdns.Record{srv})
+	assert.Nil(t, err)
+
+	// AppendRecords and SetRecords send the same priority.
+	stored := api.snapshot()
+	if assert.Len(t, stored, 2) {
+		for _, rec := range stored {
+			if assert.NotNil(t, rec.Priority) {
+				assert.Equal(t, 10, *rec.Priority)
+			}
+			assert.Equal(t, "5 5060 sip.example.com.", rec.Data)
+		}
+	}
+	if assert.Len(t, appended, 1) && assert.Len(t, set, 1) {
+		assert.Equal(t, 10, appended[0].Priority)
+		assert.Equal(t, 10, set[0].Priority)
+	}
+
+	// Updating the record through SetRecords keeps its new priority.
+	srv.Priority = 20
+	set, err = p.SetRecords(ctx, test_zone, []libdns.Record{srv})
+	assert.Nil(t, err)
+	records, err := p.GetRecords(ctx, test_zone)
+	assert.Nil(t, err)
+	if assert.Len(t, records, 1) && assert.Len(t, set, 1) {
+		assert.Equal(t, 20, set[0].Priority)
+		assert.Equal(t, set[0], records[0])
+	}
+}
+
+func TestDeleteRecordsAllOfNameAndType(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{ID: 3, Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		rfns.Record{ID: 4, Name: "api.example.com.", Type: "A", Data: "10.0.0.3", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	deleted, err := p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1", Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{ID: "2", Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+	}, deleted)
+	if stored := api.snapshot(); assert.Len(t, stored, 2) {
+		assert.Equal(t, 3, stored[0].ID)
+		assert.Equal(t, 4, stored[1].ID)
+	}
+
+	// Nothing left to delete is no error.
+	deleted, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A"}})
+	assert.Nil(t, err)
+	assert.Empty(t, deleted)
+
+	// A record with a value still has to exist.
+	_, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.1"}})
+	assert.Error(t, err)
+}
+
+func TestContextDone(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	records := []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute}}
+
+	_, err := p.GetRecords(ctx, test_zone)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = p.AppendRecords(ctx, test_zone, records)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = p.SetRecords(ctx, test_zone, records)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{{ID: "1"}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Equal(t, []rfns.Record{{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300}}, api.snapshot())
+	assert.Equal(t, 0, api.count("GET /dns/example.com/rr"))
+}
+
+func TestContextDoneWaitingForLock(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+
+	// A slow write holds the lock of the provider.
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	var once sync.Once
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodPost {
+			once.Do(func() {
+				close(entered)
+				<-release
+			})
+		}
+	}
+	done := make(chan error)
+	go func() {
+		_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{{Name: "slow", Type: "A", Value: "10.0.0.1"}})
+		done <- err
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := p.SetRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2"}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(release)
+	assert.Nil(t, <-done)
+
+	// The lock given up on is released again.
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2"}})
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 2)
+}
+
+func TestRoundRobinRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{ID: 3, Name: "example.com.", Type: "MX", Data: "mx.example.com.", TTL: 300, Priority: intPtr(10)},
+		rfns.Record{ID: 4, Name: "example.com.", Type: "MX", Data: "mx.example.com.", TTL: 300, Priority: intPtr(20)},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	// Setting the second record leaves the first untouched.
+	_, err := p.SetRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Hour}})
+	assert.Nil(t, err)
+	stored := api.snapshot()
+	assert.Equal(t, rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300}, stored[0])
+	assert.Equal(t, 3600, stored[1].TTL)
+
+	// So does deleting it.
+	deleted, err := p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2"}})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+	stored = api.snapshot()
+	if assert.Len(t, stored, 3) {
+		assert.Equal(t, 1, stored[0].ID)
+	}
+
+	// MX records of the same target are told apart by their priority.
+	_, err = p.SetRecords(ctx, test_zone, []libdns.Record{{Name: "", Type: "MX", Value: "mx.example.com.", TTL: time.Hour, Priority: 20}})
+	assert.Nil(t, err)
+	deleted, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "", Type: "MX", Value: "10 mx.example.com."}})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+	stored = api.snapshot()
+	if assert.Len(t, stored, 2) {
+		assert.Equal(t, 4, stored[1].ID)
+		assert.Equal(t, 3600, stored[1].TTL)
+	}
+
+	// Without a priority, the target alone does not pick one of two.
+	api.add(rfns.Record{ID: 5, Name: "example.com.", Type: "MX", Data: "mx.example.com.", TTL: 300, Priority: intPtr(30)})
+	_, err = p.SetRecords(ctx, test_zone, []libdns.Record{{Name: "", Type: "MX", Value: "mx.example.com.", TTL: 2 * time.Hour}})
+	assert.ErrorIs(t, err, regfish.ErrAmbiguousRecord)
+	assert.ErrorContains(t, err, "matches 2 records")
+}
+
+func TestDeleteRecordsWithSnapshotWholeRRset(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "_acme-challenge.example.com.", Type: "TXT", Data: "one", TTL: 60},
+		rfns.Record{ID: 2, Name: "_acme-challenge.example.com.", Type: "TXT", Data: "two", TTL: 60},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	snapshot, err := p.GetRecords(ctx, test_zone)
+	assert.Nil(t, err)
+	deleted, err := p.DeleteRecordsWithSnapshot(ctx, test_zone, snapshot, []libdns.Record{{Name: "_acme-challenge", Type: "TXT"}})
+	assert.Nil(t, err)
+	assert.Equal(t, snapshot, deleted)
+	assert.Empty(t, api.snapshot())
+}
+
+func TestIgnoreMissingOnDelete(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "b.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+	records := []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1"},
+		{Name: "gone", Type: "A", Value: "10.0.0.9"},
+		{Name: "b", Type: "A", Value: "10.0.0.2"},
+	}
+
+	_, err := p.DeleteRecords(ctx, test_zone, records)
+	assert.ErrorContains(t, err, "record gone of type A with data 10.0.0.9 not found")
+	assert.Len(t, api.snapshot(), 2)
+
+	p.IgnoreMissingOnDelete = true
+	deleted, err := p.DeleteRecords(ctx, test_zone, records)
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{records[0], records[2]}, deleted)
+	assert.Empty(t, api.snapshot())
+}
+
+func TestRecordIDsRoundTrip(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	records, err := p.GetRecords(ctx, test_zone)
+	assert.Nil(t, err)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	assert.Equal(t, "1002", records[1].ID)
+
+	update := records[1]
+	update.Value = "10.0.0.3"
+	result, err := p.SetRecords(ctx, test_zone, []libdns.Record{update})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1002", result[0].ID)
+	}
+
+	deleted, err := p.DeleteRecords(ctx, test_zone, records[:1])
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+
+	live := api.snapshot()
+	if assert.Len(t, live, 1) {
+		assert.Equal(t, 1002, live[0].ID)
+		assert.Equal(t, "10.0.0.3", live[0].Data)
+	}
+
+	for _, id := range []string{"www", "-1"} {
+		record := libdns.Record{ID: id, Name: "www", Type: "A", Value: "10.0.0.3"}
+		_, err = p.SetRecords(ctx, test_zone, []libdns.Record{record})
+		assert.ErrorContains(t, err, "invalid ID")
+		_, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{record})
+		assert.ErrorContains(t, err, "invalid ID")
+	}
+	assert.Len(t, api.snapshot(), 1)
+}
+
+func TestSetRecordsRRset(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		live []string
+		set  []string
+		want []string
+	}{
+		{"add to set", []string{"10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"add in front", []string{"10.0.0.1"}, []string{"10.0.0.2", "10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"replace unclaimed", []string{"10.0.0.1", "10.0.0.3"}, []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"update then create", []string{"10.0.0.1"}, []string{"10.0.0.2", "10.0.0.4"}, []string{"10.0.0.2", "10.0.0.4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newMockAPI(t)
+			for _, value := range tc.live {
+				api.add(rfns.Record{Name: "www.example.com.", Type: "A", Data: value, TTL: 300})
+			}
+
+			var records []libdns.Record
+			for _, value := range tc.set {
+				records = append(records, libdns.Record{Name: "www", Type: "A", Value: value, TTL: 5 * time.Minute})
+			}
+			result, err := api.provider().SetRecords(context.Background(), test_zone, records)
+			assert.Nil(t, err)
+			if assert.Len(t, result, len(tc.set)) {
+				for i, value := range tc.set {
+					assert.Equal(t, value, result[i].Value)
+				}
+			}
+
+			var live []string
+			for _, rec := range api.snapshot() {
+				live = append(live, rec.Data)
+			}
+			assert.ElementsMatch(t, tc.want, live)
+		})
+	}
+}
+
+func TestSetRecordsApexAlias(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "ALIAS", Data: "cdn.example.net.", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "ALIAS", Data: "backup.example.net.", TTL: 300},
+	)
+	p := api.provider()
+
+	// The target given in another case and without the trailing dot still
+	// picks the record holding it.
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "@", Type: "ALIAS", Value: "CDN.example.net", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1001", result[0].ID)
+		assert.Equal(t, "ALIAS", result[0].Type)
+		assert.Equal(t, "", result[0].Name)
+	}
+	assert.Len(t, api.snapshot(), 2)
+}
+
+func TestSetRecordsDNAME(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "old.example.com.", Type: "DNAME", Data: "example.net.", TTL: 300},
+		rfns.Record{Name: "www.old.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+	ctx := context.Background()
+
+	result, err := p.SetRecords(ctx, test_zone, []libdns.Record{
+		{Name: "old", Type: "DNAME", Value: "example.org.", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1001", result[0].ID)
+		assert.Equal(t, "DNAME", result[0].Type)
+		assert.Equal(t, "example.org.", result[0].Value)
+	}
+	assert.Len(t, api.snapshot(), 2)
+
+	_, err = p.SetRecords(ctx, test_zone, []libdns.Record{
+		{Name: "old", Type: "DNAME", Value: "example.org.", TTL: time.Hour},
+		{Name: "OLD", Type: "dname", Value: "example.net.", TTL: time.Hour},
+	})
+	assert.ErrorContains(t, err, "can only hold one")
+
+	_, err = p.AppendRecords(ctx, test_zone, []libdns.Record{
+		{Name: "new", Type: "CNAME", Value: "a.example.net.", TTL: time.Hour},
+		{Name: "new", Type: "CNAME", Value: "A.example.net", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+}
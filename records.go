@@ -0,0 +1,260 @@
+package regfish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// GlueRecords returns the glue records among records of zone: A and AAAA
+// records of name servers that live at or below a delegation (an NS record
+// set other than at the zone apex) they serve. GetRecords returns glue like
+// any other record, since the regfish API does not distinguish it; callers
+// changing a delegation can use this to find the addresses that have to be
+// kept in sync with it. DeleteRecords and SetRecords refuse to delete the
+// last glue record of a name server a delegation kept in place relies on.
+func GlueRecords(records []libdns.Record, zone string) []libdns.Record {
+	zone = strings.TrimSuffix(zone, ".")
+
+	// name server host -> delegated name it serves
+	nameServers := make(map[string][]string)
+	for _, rec := range records {
+		if !strings.EqualFold(rec.Type, "NS") || rec.Name == "" || rec.Name == "@" {
+			continue
+		}
+		host := strings.ToLower(stripZone(rec.Value, zone))
+		nameServers[host] = append(nameServers[host], strings.ToLower(stripZone(rec.Name, zone)))
+	}
+
+	var glue []libdns.Record
+	for _, rec := range records {
+		if !strings.EqualFold(rec.Type, "A") && !strings.EqualFold(rec.Type, "AAAA") {
+			continue
+		}
+		name := strings.ToLower(stripZone(rec.Name, zone))
+		for _, delegation := range nameServers[name] {
+			if name == delegation || strings.HasSuffix(name, "."+delegation) {
+				glue = append(glue, rec)
+				break
+			}
+		}
+	}
+
+	return glue
+}
+
+// forwardingTypes are the pseudo record types used for web forwarding.
+var forwardingTypes = map[string]bool{
+	"URL":      true,
+	"URL301":   true,
+	"URL302":   true,
+	"FRAME":    true,
+	"REDIRECT": true,
+}
+
+// IsForwardingRecord reports whether record is a web forwarding (redirect)
+// entry rather than a DNS record. regfish configures forwarding outside of
+// DNS; should its API list forwarding entries among the records of a zone,
+// GetRecords returns them with their pseudo type (e.g. "URL" or "FRAME")
+// instead of passing them off as CNAME or A records, and the Provider
+// refuses to create, update or delete them.
+func IsForwardingRecord(record libdns.Record) bool {
+	return forwardingTypes[strings.ToUpper(record.Type)]
+}
+
+// RecordsEqual reports whether a and b describe the same DNS record. Names,
+// types and host name values are compared case-insensitively, IP addresses
+// in their canonical form, and a trailing dot on host names is ignored.
+// Record IDs are never compared; TTLs only if ignoreTTL is false.
+func RecordsEqual(a, b libdns.Record, ignoreTTL bool) bool {
+	if !strings.EqualFold(normalizeName(a.Name), normalizeName(b.Name)) ||
+		!strings.EqualFold(a.Type, b.Type) ||
+		a.Priority != b.Priority {
+		return false
+	}
+	if !ignoreTTL && a.TTL != b.TTL {
+		return false
+	}
+	return normalizeValue(a.Type, a.Value) == normalizeValue(b.Type, b.Value)
+}
+
+// normalizeName maps the apex markers "@" and "" to "" and strips a
+// trailing dot.
+func normalizeName(name string) string {
+	if name == "@" {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// normalizeValue returns the canonical form of a record value for
+// comparison.
+func normalizeValue(recordType, value string) string {
+	value = strings.TrimSpace(value)
+	if isGenericData(value) {
+		return canonicalData(recordType, value)
+	}
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA":
+		return canonicalData(recordType, value)
+	case "CNAME", "NS", "PTR", "DNAME", "ALIAS", "ANAME", "MX", "SRV", "RP":
+		return strings.TrimSuffix(strings.ToLower(strings.Join(strings.Fields(value), " ")), ".")
+	case "TXT":
+		return joinTXT(value)
+	case "SPF":
+		return value
+	case "TLSA", "SMIMEA", "CERT", "OPENPGPKEY", "DS", "CDS", "DNSKEY", "CDNSKEY", "LOC", "URI", "HINFO":
+		return canonicalData(recordType, value)
+	default:
+		return strings.Join(strings.Fields(value), " ")
+	}
+}
+
+// FormatRecord renders a record of zone as a tab-separated line in zone file
+// format, for example "www.example.com. 300 IN A 192.0.2.1". The priority
+// of MX, SRV, URI, HTTPS and SVCB records is written in front of the
+// value, and TXT values are quoted unless they already are, split into
+// character-strings of at most 255 bytes if longer. The output is meant
+// for logs and change previews; it is stable, so it diffs well.
+func FormatRecord(record libdns.Record, zone string) string {
+	value := record.Value
+	switch strings.ToUpper(record.Type) {
+	case "MX", "SRV", "URI", "HTTPS", "SVCB":
+		value = fmt.Sprintf("%d %s", record.Priority, value)
+	case "TXT", "SPF":
+		value = quoteTXT(chunkTXT(value))
+	}
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", fqdn(record.Name, zone), int(record.TTL.Seconds()), strings.ToUpper(record.Type), value)
+}
+
+// quoteTXT returns value as a quoted character-string, unless it is
+// already quoted.
+func quoteTXT(value string) string {
+	if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+		return value
+	}
+	return quoteCharacterString(value)
+}
+
+// CNAMEChain describes where a CNAME record ultimately points.
+type CNAMEChain struct {
+	// Name is the name of the CNAME record, relative to the zone.
+	Name string
+
+	// Targets are the successive CNAME targets, as found in the records,
+	// ending with the first target that is outside the zone or not itself
+	// a CNAME record.
+	Targets []string
+
+	// Loop is true if the chain leads back to a name already visited, in
+	// which case Targets ends with that name.
+	Loop bool
+}
+
+// CNAMEChains follows the CNAME records of zone within the zone and returns
+// a chain for each CNAME record, in the order of records. This is meant
+// for diagnostics; nothing is resolved through DNS.
+func CNAMEChains(records []libdns.Record, zone string) []CNAMEChain {
+	zone = strings.TrimSuffix(zone, ".")
+
+	targets := make(map[string]string)
+	for _, rec := range records {
+		if strings.EqualFold(rec.Type, "CNAME") {
+			targets[strings.ToLower(normalizeName(rec.Name))] = rec.Value
+		}
+	}
+
+	var chains []CNAMEChain
+	for _, rec := range records {
+		if !strings.EqualFold(rec.Type, "CNAME") {
+			continue
+		}
+
+		chain := CNAMEChain{Name: rec.Name}
+		seen := map[string]bool{strings.ToLower(normalizeName(rec.Name)): true}
+		target := rec.Value
+		for {
+			chain.Targets = append(chain.Targets, target)
+
+			name, inZone := zoneRelative(target, zone)
+			if !inZone {
+				break
+			}
+			if seen[name] {
+				chain.Loop = true
+				break
+			}
+			seen[name] = true
+
+			next, ok := targets[name]
+			if !ok {
+				break
+			}
+			target = next
+		}
+		chains = append(chains, chain)
+	}
+
+	return chains
+}
+
+// zoneRelative returns the lowercased name of target relative to zone, and
+// whether target is within zone at all. Targets without a trailing dot are
+// relative to the zone, as in a zone file.
+func zoneRelative(target, zone string) (string, bool) {
+	target = strings.ToLower(target)
+	zone = strings.ToLower(zone)
+	if !strings.HasSuffix(target, ".") {
+		return normalizeName(target), true
+	}
+	target = strings.TrimSuffix(target, ".")
+	if target == zone {
+		return "", true
+	}
+	if strings.HasSuffix(target, "."+zone) {
+		return strings.TrimSuffix(target, "."+zone), true
+	}
+	return "", false
+}
+
+// ZoneHash returns a hash of all records in the zone, so that callers can
+// detect changes by comparing hashes over time. See HashRecords for what
+// the hash covers. Pass a context from WithoutCache if caching is enabled
+// and the hash must reflect the current state.
+func (p *Provider) ZoneHash(ctx context.Context, zone string) (string, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	return HashRecords(records), nil
+}
+
+// HashRecords returns a hex-encoded SHA-256 hash of records. The hash
+// depends on the name, type, value, TTL and priority of the records, in
+// the normalized form RecordsEqual compares, but not on their order or
+// IDs, so two lists of equal records hash the same.
+func HashRecords(records []libdns.Record) string {
+	lines := make([]string, 0, len(records))
+	for _, rec := range records {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%d\t%s",
+			strings.ToLower(normalizeName(rec.Name)),
+			strings.ToUpper(rec.Type),
+			int64(rec.TTL.Seconds()),
+			rec.Priority,
+			normalizeValue(rec.Type, rec.Value),
+		))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,266 @@
+package regfish_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlueRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "NS", Data: "ns1.example.com.", TTL: 86400},
+		rfns.Record{Name: "ns1.example.com.", Type: "A", Data: "192.0.2.1", TTL: 86400},
+		rfns.Record{Name: "sub.example.com.", Type: "NS", Data: "ns.sub.example.com.", TTL: 86400},
+		rfns.Record{Name: "sub.example.com.", Type: "NS", Data: "ns.example.net.", TTL: 86400},
+		rfns.Record{Name: "ns.sub.example.com.", Type: "A", Data: "192.0.2.53", TTL: 86400},
+		rfns.Record{Name: "ns.sub.example.com.", Type: "AAAA", Data: "2001:db8::53", TTL: 86400},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "192.0.2.80", TTL: 300},
+	)
+
+	records, err := api.provider().GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Len(t, records, 7)
+
+	glue := regfish.GlueRecords(records, test_zone)
+	if assert.Len(t, glue, 2) {
+		assert.Equal(t, "ns.sub", glue[0].Name)
+		assert.Equal(t, "A", glue[0].Type)
+		assert.Equal(t, "ns.sub", glue[1].Name)
+		assert.Equal(t, "AAAA", glue[1].Type)
+	}
+}
+
+func TestGlueRecordsCase(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "sub", Type: "NS", Value: "NS1.SUB.EXAMPLE.COM."},
+		{Name: "ns1.sub", Type: "A", Value: "192.0.2.53"},
+		// not below the zone, despite the common suffix
+		{Name: "other", Type: "NS", Value: "ns.otherexample.com."},
+		{Name: "ns.other", Type: "A", Value: "192.0.2.54"},
+	}
+
+	glue := regfish.GlueRecords(records, test_zone)
+	if assert.Len(t, glue, 1) {
+		assert.Equal(t, "ns1.sub", glue[0].Name)
+	}
+}
+
+func TestGlueSurvivesNSUpdate(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "sub.example.com.", Type: "NS", Data: "ns.sub.example.com.", TTL: 86400},
+		rfns.Record{Name: "sub.example.com.", Type: "NS", Data: "ns.example.net.", TTL: 86400},
+		rfns.Record{Name: "ns.sub.example.com.", Type: "A", Data: "192.0.2.53", TTL: 86400},
+		rfns.Record{Name: "ns.sub.example.com.", Type: "AAAA", Data: "2001:db8::53", TTL: 86400},
+	)
+	p := api.provider()
+	p.ReplaceRRsets = true
+	ctx := context.Background()
+
+	_, err := p.SetRecords(ctx, test_zone, []libdns.Record{
+		{Name: "sub", Type: "NS", Value: "ns.sub.example.com.", TTL: 24 * time.Hour},
+		{Name: "sub", Type: "NS", Value: "ns2.example.net.", TTL: 24 * time.Hour},
+	})
+	assert.Nil(t, err)
+	records, err := p.GetRecords(ctx, test_zone)
+	assert.Nil(t, err)
+	assert.Len(t, regfish.GlueRecords(records, test_zone), 2)
+
+	// The last addresses of a name server the delegation relies on are
+	// protected; one of them alone is not.
+	_, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{
+		{Name: "ns.sub", Type: "A"},
+		{Name: "ns.sub", Type: "AAAA"},
+	})
+	assert.ErrorIs(t, err, regfish.ErrProtectedRecord)
+	assert.Len(t, api.snapshot(), 4)
+
+	deleted, err := p.DeleteRecords(ctx, test_zone, []libdns.Record{{Name: "ns.sub", Type: "AAAA"}})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+
+	// Together with the delegation, the glue may go.
+	deleted, err = p.DeleteRecords(ctx, test_zone, []libdns.Record{
+		{Name: "sub", Type: "NS"},
+		{Name: "ns.sub", Type: "A"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 3)
+	assert.Empty(t, api.snapshot())
+}
+
+func TestRecordsEqual(t *testing.T) {
+	base := libdns.Record{ID: "1", Type: "A", Name: "www", Value: "192.0.2.1", TTL: 300 * time.Second}
+
+	tests := []struct {
+		name      string
+		a, b      libdns.Record
+		ignoreTTL bool
+		want      bool
+	}{
+		{"identical", base, base, false, true},
+		{"different ID", base, libdns.Record{ID: "2", Type: "A", Name: "www", Value: "192.0.2.1", TTL: 300 * time.Second}, false, true},
+		{"different TTL", base, libdns.Record{Type: "A", Name: "www", Value: "192.0.2.1", TTL: time.Hour}, false, false},
+		{"different TTL ignored", base, libdns.Record{Type: "A", Name: "www", Value: "192.0.2.1", TTL: time.Hour}, true, true},
+		{"name case", base, libdns.Record{Type: "a", Name: "WWW", Value: "192.0.2.1", TTL: 300 * time.Second}, false, true},
+		{"different value", base, libdns.Record{Type: "A", Name: "www", Value: "192.0.2.2", TTL: 300 * time.Second}, false, false},
+		{"different type", base, libdns.Record{Type: "AAAA", Name: "www", Value: "192.0.2.1", TTL: 300 * time.Second}, false, false},
+		{"apex markers", libdns.Record{Type: "TXT", Name: "@", Value: "x"}, libdns.Record{Type: "TXT", Name: "", Value: "x"}, false, true},
+		{"IPv6 canonical form",
+			libdns.Record{Type: "AAAA", Name: "www", Value: "2001:0db8:0000:0000:0000:0000:0000:0001"},
+			libdns.Record{Type: "AAAA", Name: "www", Value: "2001:db8::1"}, false, true},
+		{"IPv4-mapped IPv6", libdns.Record{Type: "AAAA", Name: "www", Value: "::ffff:192.0.2.1"}, libdns.Record{Type: "AAAA", Name: "www", Value: "::FFFF:192.0.2.1"}, false, true},
+		{"target case and trailing dot",
+			libdns.Record{Type: "CNAME", Name: "www", Value: "Target.Example.NET."},
+			libdns.Record{Type: "CNAME", Name: "www", Value: "target.example.net"}, false, true},
+		{"MX priority",
+			libdns.Record{Type: "MX", Name: "", Value: "mx.example.net.", Priority: 10},
+			libdns.Record{Type: "MX", Name: "", Value: "mx.example.net.", Priority: 20}, false, false},
+		{"TXT is case-sensitive",
+			libdns.Record{Type: "TXT", Name: "", Value: "Token"},
+			libdns.Record{Type: "TXT", Name: "", Value: "token"}, false, false},
+		{"CAA whitespace",
+			libdns.Record{Type: "CAA", Name: "", Value: `0 issue  "letsencrypt.org"`},
+			libdns.Record{Type: "CAA", Name: "", Value: `0 issue "letsencrypt.org"`}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, regfish.RecordsEqual(tt.a, tt.b, tt.ignoreTTL))
+			assert.Equal(t, tt.want, regfish.RecordsEqual(tt.b, tt.a, tt.ignoreTTL))
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestFormatRecord(t *testing.T) {
+	records := []libdns.Record{
+		{Type: "A", Name: "www", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Type: "AAAA", Name: "www", Value: "2001:db8::1", TTL: 300 * time.Second},
+		{Type: "CNAME", Name: "blog", Value: "www.example.com.", TTL: time.Hour},
+		{Type: "MX", Name: "", Value: "mx.example.net.", TTL: time.Hour, Priority: 10},
+		{Type: "NS", Name: "", Value: "ns1.example.com.", TTL: 24 * time.Hour},
+		{Type: "NS", Name: "@", Value: "ns2.example.com.", TTL: 24 * time.Hour},
+		{Type: "SRV", Name: "_sip._udp", Value: "5 5060 sip.example.com.", TTL: time.Hour, Priority: 10},
+		{Type: "TXT", Name: "", Value: "v=spf1 -all", TTL: time.Hour},
+		{Type: "TXT", Name: "quoted", Value: `"already quoted"`, TTL: time.Hour},
+		{Type: "TXT", Name: "escaped", Value: `say "hi" \o/`, TTL: time.Hour},
+		{Type: "CAA", Name: "", Value: `0 issue "letsencrypt.org"`, TTL: time.Hour},
+		{Type: "HTTPS", Name: "", Value: ". alpn=h2,h3", TTL: time.Hour, Priority: 1},
+		{Type: "tlsa", Name: "_443._tcp.www", Value: "3 1 1 0123456789abcdef", TTL: time.Hour},
+	}
+
+	var lines []string
+	for _, rec := range records {
+		lines = append(lines, regfish.FormatRecord(rec, "example.com."))
+	}
+	got := strings.Join(lines, "\n") + "\n"
+
+	golden := filepath.Join("testdata", "format.golden")
+	if *update {
+		assert.Nil(t, os.WriteFile(golden, []byte(got), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), got)
+}
+
+func TestForwardingRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "go.example.com.", Type: "URL", Data: "https://example.org/", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "CNAME", Data: "example.com.", TTL: 300},
+	)
+	p := api.provider()
+
+	records, err := p.GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "URL", records[0].Type)
+		assert.True(t, regfish.IsForwardingRecord(records[0]))
+		assert.False(t, regfish.IsForwardingRecord(records[1]))
+	}
+
+	forward := libdns.Record{Name: "go", Type: "URL", Value: "https://example.net/"}
+	_, err = p.AppendRecords(context.Background(), test_zone, []libdns.Record{forward})
+	assert.ErrorContains(t, err, "forwarding record")
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{forward})
+	assert.ErrorContains(t, err, "forwarding record")
+	_, err = p.DeleteRecords(context.Background(), test_zone, []libdns.Record{records[0]})
+	assert.ErrorContains(t, err, "forwarding record")
+
+	assert.Len(t, api.snapshot(), 2)
+}
+
+func TestCNAMEChains(t *testing.T) {
+	records := []libdns.Record{
+		{Type: "CNAME", Name: "www", Value: "web.example.com."},
+		{Type: "CNAME", Name: "web", Value: "LB.example.com."},
+		{Type: "CNAME", Name: "lb", Value: "cdn.example.net."},
+		{Type: "A", Name: "app", Value: "192.0.2.1"},
+		{Type: "CNAME", Name: "api", Value: "app"},
+		{Type: "CNAME", Name: "ping", Value: "pong.example.com."},
+		{Type: "CNAME", Name: "pong", Value: "ping.example.com."},
+		{Type: "CNAME", Name: "self", Value: "self.example.com."},
+	}
+
+	chains := regfish.CNAMEChains(records, "example.com.")
+	assert.Equal(t, []regfish.CNAMEChain{
+		{Name: "www", Targets: []string{"web.example.com.", "LB.example.com.", "cdn.example.net."}},
+		{Name: "web", Targets: []string{"LB.example.com.", "cdn.example.net."}},
+		{Name: "lb", Targets: []string{"cdn.example.net."}},
+		{Name: "api", Targets: []string{"app"}},
+		{Name: "ping", Targets: []string{"pong.example.com.", "ping.example.com."}, Loop: true},
+		{Name: "pong", Targets: []string{"ping.example.com.", "pong.example.com."}, Loop: true},
+		{Name: "self", Targets: []string{"self.example.com."}, Loop: true},
+	}, chains)
+}
+
+func TestZoneHash(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "MX", Data: "mx.example.net.", TTL: 3600, Priority: intPtr(10)},
+	)
+	p := api.provider()
+
+	first, err := p.ZoneHash(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Len(t, first, 64)
+
+	second, err := p.ZoneHash(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Hour}})
+	assert.Nil(t, err)
+
+	third, err := p.ZoneHash(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, third)
+}
+
+func TestHashRecords(t *testing.T) {
+	records := []libdns.Record{
+		{ID: "1", Type: "A", Name: "www", Value: "192.0.2.1", TTL: time.Minute},
+		{ID: "2", Type: "AAAA", Name: "www", Value: "2001:db8::1", TTL: time.Minute},
+		{ID: "3", Type: "MX", Name: "", Value: "mx.example.net.", TTL: time.Hour, Priority: 10},
+	}
+	reordered := []libdns.Record{
+		{Type: "mx", Name: "@", Value: "MX.example.net", TTL: time.Hour, Priority: 10},
+		{Type: "AAAA", Name: "WWW", Value: "2001:0db8::0001", TTL: time.Minute},
+		{Type: "A", Name: "www", Value: "192.0.2.1", TTL: time.Minute},
+	}
+	assert.Equal(t, regfish.HashRecords(records), regfish.HashRecords(reordered))
+
+	changed := append([]libdns.Record(nil), records...)
+	changed[2].Priority = 20
+	assert.NotEqual(t, regfish.HashRecords(records), regfish.HashRecords(changed))
+}
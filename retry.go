@@ -0,0 +1,233 @@
+package regfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// defaultRetryBackoff is the default for Provider.RetryBackoff.
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// defaultRequestAttempts is the default for Provider.RequestAttempts.
+const defaultRequestAttempts = 3
+
+// defaultRequestBackoff is the default for Provider.RequestBackoff.
+const defaultRequestBackoff = 500 * time.Millisecond
+
+// maxRetryBackoff caps the delay between two retries.
+const maxRetryBackoff = 30 * time.Second
+
+// Jitter selects how retry delays are randomized.
+type Jitter int
+
+const (
+	// FullJitter picks a delay between zero and the backoff.
+	FullJitter Jitter = iota
+
+	// EqualJitter picks a delay between half the backoff and the
+	// backoff, trading some spread for a guaranteed minimum delay.
+	EqualJitter
+
+	// NoJitter uses the backoff as is. Provider instances retrying after
+	// the same failure then retry in lockstep.
+	NoJitter
+)
+
+// String returns the name of the jitter mode.
+func (j Jitter) String() string {
+	switch j {
+	case FullJitter:
+		return "full"
+	case EqualJitter:
+		return "equal"
+	case NoJitter:
+		return "none"
+	}
+	return "unknown"
+}
+
+// jitterRand is seeded per process, so that separate processes do not
+// draw the same delays.
+var (
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex sync.Mutex
+)
+
+// RetryPolicy overrides the retry settings of a Provider for records of a
+// type. Fields left zero keep the setting of the Provider.
+type RetryPolicy struct {
+	// Attempts overrides Provider.UpsertAttempts.
+	Attempts int
+
+	// Backoff overrides Provider.RetryBackoff.
+	Backoff time.Duration
+}
+
+// checkRetryPolicies returns an error if RetryPolicies has several keys
+// for one record type, such as "txt" and "TXT", of which retryPolicy
+// could not pick one.
+func (p *Provider) checkRetryPolicies() error {
+	types := make([]string, 0, len(p.RetryPolicies))
+	for typ := range p.RetryPolicies {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	seen := make(map[string]string, len(types))
+	for _, typ := range types {
+		if other, ok := seen[strings.ToUpper(typ)]; ok {
+			return fmt.Errorf("retry policies are given for both %q and %q", other, typ)
+		}
+		seen[strings.ToUpper(typ)] = typ
+	}
+	return nil
+}
+
+// retryPolicy returns the retry settings for records of the given type:
+// those of its entry in RetryPolicies, where set, and those of the
+// Provider, or their defaults, otherwise.
+func (p *Provider) retryPolicy(recordType string) RetryPolicy {
+	policy := RetryPolicy{Attempts: p.UpsertAttempts, Backoff: p.RetryBackoff}
+	for typ, override := range p.RetryPolicies {
+		if !strings.EqualFold(typ, recordType) {
+			continue
+		}
+		if override.Attempts > 0 {
+			policy.Attempts = override.Attempts
+		}
+		if override.Backoff > 0 {
+			policy.Backoff = override.Backoff
+		}
+	}
+	if policy.Attempts <= 0 {
+		policy.Attempts = defaultUpsertAttempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	return policy
+}
+
+// retryDelay returns how long to wait before retry number attempt of a
+// write of a record of the given type, counting from 1: the backoff
+// doubles with each attempt, up to maxRetryBackoff, and is randomized
+// according to RetryJitter.
+func (p *Provider) retryDelay(recordType string, attempt int) time.Duration {
+	return p.backoffDelay(p.retryPolicy(recordType).Backoff, attempt)
+}
+
+// backoffDelay returns how long to wait before retry number attempt,
+// counting from 1, given the delay before the first retry: the backoff
+// doubles with each attempt, up to maxRetryBackoff, and is randomized
+// according to RetryJitter.
+func (p *Provider) backoffDelay(backoff time.Duration, attempt int) time.Duration {
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	switch p.RetryJitter {
+	case NoJitter:
+		return backoff
+	case EqualJitter:
+		return backoff/2 + randDuration(backoff/2)
+	default:
+		return randDuration(backoff)
+	}
+}
+
+// randDuration returns a random duration in [0, max].
+func randDuration(max time.Duration) time.Duration {
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max) + 1))
+}
+
+// waitForRetry blocks for the delay before retry number attempt of a write
+// of a record of the given type, or until ctx is done.
+func (p *Provider) waitForRetry(ctx context.Context, recordType string, attempt int) error {
+	return p.sleep(ctx, p.retryDelay(recordType, attempt))
+}
+
+// requestAttempts returns how often a request may be made in total.
+func (p *Provider) requestAttempts() int {
+	if p.RequestAttempts > 0 {
+		return p.RequestAttempts
+	}
+	return defaultRequestAttempts
+}
+
+// requestBackoff returns the delay before the first retry of a request.
+func (p *Provider) requestBackoff() time.Duration {
+	if p.RequestBackoff > 0 {
+		return p.RequestBackoff
+	}
+	return defaultRequestBackoff
+}
+
+// retryableRequest reports whether a request that failed with err may be
+// retried: it was rate limited, regfish is down for maintenance, which it
+// reports before handling the request, or it failed with another server
+// error and is idempotent.
+func retryableRequest(err error, idempotent bool) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch {
+	case apiErr.HTTPStatus == http.StatusTooManyRequests, apiErr.Maintenance:
+		return true
+	case apiErr.HTTPStatus >= 500:
+		return idempotent
+	}
+	return false
+}
+
+// requestDelay returns how long to wait before retry number attempt of a
+// request that failed with err: the Retry-After delay of the response, if
+// any, up to maxRetryBackoff, and the backoff of RequestBackoff otherwise.
+func (p *Provider) requestDelay(err error, attempt int) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > maxRetryBackoff {
+			return maxRetryBackoff
+		}
+		return apiErr.RetryAfter
+	}
+	return p.backoffDelay(p.requestBackoff(), attempt)
+}
+
+// do makes a request to the regfish API by calling call with a client
+// bound to ctx, within the limit of MaxConcurrentRequests. Requests that
+// fail with a rate limit, maintenance or, if idempotent, another server
+// error are retried as RequestAttempts says. Waiting for a retry ends
+// early when ctx is done, returning the error of ctx.
+func (p *Provider) do(ctx context.Context, idempotent bool, call func(client *rfns.Client) error) error {
+	attempts := p.requestAttempts()
+	for attempt := 1; ; attempt++ {
+		release, err := p.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		err = call(p.clientFor(ctx))
+		release()
+
+		if err == nil || attempt >= attempts || !retryableRequest(err, idempotent) {
+			return err
+		}
+		if werr := p.sleep(ctx, p.requestDelay(err, attempt)); werr != nil {
+			return fmt.Errorf("%w (while waiting to retry after: %v)", werr, err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package regfish_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelayJitter(t *testing.T) {
+	tests := []struct {
+		jitter   regfish.Jitter
+		attempt  int
+		min, max time.Duration
+	}{
+		{regfish.FullJitter, 1, 0, time.Second},
+		{regfish.FullJitter, 3, 0, 4 * time.Second},
+		{regfish.EqualJitter, 1, 500 * time.Millisecond, time.Second},
+		{regfish.EqualJitter, 2, time.Second, 2 * time.Second},
+		{regfish.NoJitter, 2, 2 * time.Second, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		p := &regfish.Provider{RetryBackoff: time.Second, RetryJitter: tt.jitter}
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 100; i++ {
+			delay := regfish.RetryDelay(p, "A", tt.attempt)
+			assert.GreaterOrEqual(t, delay, tt.min, "%s jitter, attempt %d", tt.jitter, tt.attempt)
+			assert.LessOrEqual(t, delay, tt.max, "%s jitter, attempt %d", tt.jitter, tt.attempt)
+			seen[delay] = true
+		}
+		if tt.jitter == regfish.NoJitter {
+			assert.Len(t, seen, 1)
+		} else {
+			assert.Greater(t, len(seen), 50, "%s jitter delays are not randomized", tt.jitter)
+		}
+	}
+}
+
+func TestRetryDelayCapped(t *testing.T) {
+	p := &regfish.Provider{RetryJitter: regfish.NoJitter}
+	assert.Equal(t, 100*time.Millisecond, regfish.RetryDelay(p, "A", 1))
+	assert.Equal(t, 30*time.Second, regfish.RetryDelay(p, "A", 50))
+}
+
+func TestRetryPolicies(t *testing.T) {
+	p := &regfish.Provider{
+		RetryBackoff: time.Second,
+		RetryJitter:  regfish.NoJitter,
+		RetryPolicies: map[string]regfish.RetryPolicy{
+			"txt": {Backoff: 10 * time.Millisecond},
+		},
+	}
+
+	assert.Equal(t, 10*time.Millisecond, regfish.RetryDelay(p, "TXT", 1))
+	assert.Equal(t, 20*time.Millisecond, regfish.RetryDelay(p, "TXT", 2))
+	assert.Equal(t, time.Second, regfish.RetryDelay(p, "A", 1))
+}
+
+func TestRetryPoliciesCollide(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.RetryPolicies = map[string]regfish.RetryPolicy{
+		"txt": {Attempts: 2},
+		"TXT": {Attempts: 6},
+	}
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.EqualError(t, err, `retry policies are given for both "TXT" and "txt"`)
+	assert.Equal(t, 0, api.count("GET /dns/example.com/rr"))
+}
+
+func TestRetryPoliciesAttempts(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "old", TTL: 300},
+	)
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodPatch {
+			return http.StatusConflict, ""
+		}
+		return 0, ""
+	}
+
+	p := api.provider()
+	p.Clock = newFakeClock()
+	p.RetryPolicies = map[string]regfish.RetryPolicy{"TXT": {Attempts: 6}}
+
+	_, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{{Name: "www", Type: "A", Value: "10.0.0.2"}})
+	assert.Error(t, err)
+	assert.Equal(t, 3, api.count("PATCH /dns/rr/1001"))
+
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{{Name: "_acme-challenge", Type: "TXT", Value: "new"}})
+	assert.Error(t, err)
+	assert.Equal(t, 6, api.count("PATCH /dns/rr/1002"))
+}
+
+func TestRequestRetryRateLimited(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	failures := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodPost && failures < 2 {
+			failures++
+			return http.StatusTooManyRequests, `{"message": "rate limit exceeded"}`
+		}
+		return 0, ""
+	}
+	api.failHeader = http.Header{"Retry-After": {"2"}}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	result, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "api", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, 3, api.count("POST /dns/rr"))
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second}, clock.slept)
+}
+
+func TestRequestRetryAfterDate(t *testing.T) {
+	api := newMockAPI(t)
+	clock := newFakeClock()
+	failures := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if failures < 1 {
+			failures++
+			return http.StatusTooManyRequests, `{"message": "rate limit exceeded"}`
+		}
+		return 0, ""
+	}
+	api.failHeader = http.Header{"Retry-After": {clock.Now().Add(5 * time.Second).Format(http.TimeFormat)}}
+
+	p := api.provider()
+	p.Clock = clock
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Second}, clock.slept)
+}
+
+func TestRequestRetryServerError(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusBadGateway, ""
+	}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+	p.RequestAttempts = 4
+	p.RequestBackoff = time.Second
+	p.RetryJitter = regfish.NoJitter
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.Error(t, err)
+	assert.Equal(t, 4, api.count("GET /dns/example.com/rr"))
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, clock.slept)
+
+	// Creates are not retried after server errors, as they may have been
+	// made.
+	_, err = p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "api", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, api.count("POST /dns/rr"))
+}
+
+func TestRequestNoRetryClientError(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusBadRequest, `{"message": "invalid record"}`
+	}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "api", Type: "A", Value: "10.0.0.2", TTL: time.Minute},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, api.count("POST /dns/rr"))
+	assert.Empty(t, clock.slept)
+}
+
+func TestRequestRetryContextDeadline(t *testing.T) {
+	api := newMockAPI(t)
+	api.fail = func(r *http.Request) (int, string) {
+		return http.StatusTooManyRequests, ""
+	}
+	api.failHeader = http.Header{"Retry-After": {"3600"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := api.provider().GetRecords(ctx, test_zone)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+}
+
+func TestRequestRetryMaintenanceCreate(t *testing.T) {
+	api := newMockAPI(t)
+	failures := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodPost && failures < 1 {
+			failures++
+			return http.StatusServiceUnavailable, `{"code": "maintenance"}`
+		}
+		return 0, ""
+	}
+	api.failHeader = http.Header{"Retry-After": {"5"}}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	result, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, 2, api.count("POST /dns/rr"))
+	assert.Equal(t, []time.Duration{5 * time.Second}, clock.slept)
+	assert.Len(t, api.snapshot(), 1)
+}
+
+func TestRequestRetryAfterCapped(t *testing.T) {
+	api := newMockAPI(t)
+	failures := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if failures < 1 {
+			failures++
+			return http.StatusTooManyRequests, ""
+		}
+		return 0, ""
+	}
+	api.failHeader = http.Header{"Retry-After": {"3600"}}
+
+	clock := newFakeClock()
+	p := api.provider()
+	p.Clock = clock
+
+	_, err := p.GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{30 * time.Second}, clock.slept)
+}
+
+func TestRequestRetryDeleteGone(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	// The first delete is made, but its response is lost to a server
+	// error.
+	failed := false
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodDelete && !failed {
+			api.remove(1)
+		}
+	}
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method == http.MethodDelete && !failed {
+			failed = true
+			return http.StatusBadGateway, ""
+		}
+		return 0, ""
+	}
+
+	p := api.provider()
+	p.Clock = newFakeClock()
+
+	deleted, err := p.DeleteRecords(context.Background(), test_zone, []libdns.Record{{ID: "1"}})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+	assert.Equal(t, 2, api.count("DELETE /dns/rr/1"))
+	assert.Empty(t, api.snapshot())
+}
@@ -0,0 +1,81 @@
+package regfish
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ReverseName returns the fully qualified name of the PTR record of ip,
+// such as "1.2.0.192.in-addr.arpa." for 192.0.2.1 or the nibble form
+// under "ip6.arpa." for an IPv6 address. It returns "" if ip is invalid.
+func ReverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return ""
+	}
+	var b strings.Builder
+	for i := len(ip6) - 1; i >= 0; i-- {
+		b.WriteString(strconv.FormatUint(uint64(ip6[i]&0xf), 16))
+		b.WriteByte('.')
+		b.WriteString(strconv.FormatUint(uint64(ip6[i]>>4), 16))
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// ReverseZone returns the name of the reverse zone of network, such as
+// "2.0.192.in-addr.arpa." for 192.0.2.0/24 or "8.b.d.0.1.0.0.2.ip6.arpa."
+// for 2001:db8::/32. The prefix length must be a multiple of 8 for IPv4
+// and of 4 for IPv6, as reverse zones are delegated on label boundaries.
+func ReverseZone(network *net.IPNet) (string, error) {
+	ones, bits := network.Mask.Size()
+	name := ReverseName(network.IP.Mask(network.Mask))
+	if name == "" || bits == 0 {
+		return "", fmt.Errorf("invalid network %s", network)
+	}
+	labelBits := 4
+	if bits == 32 {
+		labelBits = 8
+	}
+	if ones%labelBits != 0 {
+		return "", fmt.Errorf("prefix length of %s is no multiple of %d", network, labelBits)
+	}
+	labels := strings.Split(name, ".")
+	// labels holds one label per address unit, then "in-addr" or "ip6",
+	// "arpa" and "".
+	units := bits / labelBits
+	return strings.Join(labels[units-ones/labelBits:], "."), nil
+}
+
+// PTRRecord returns the PTR record pointing ip to the host target, with a
+// name relative to the reverse zone zone, such as "1" for 192.0.2.1 in
+// zone "2.0.192.in-addr.arpa.". It returns an error if ip does not belong
+// into zone.
+func PTRRecord(ip net.IP, zone, target string, ttl time.Duration) (libdns.Record, error) {
+	name := ReverseName(ip)
+	if name == "" {
+		return libdns.Record{}, fmt.Errorf("invalid IP address %s", ip)
+	}
+	relative := stripZone(name, zone)
+	if relative == strings.TrimSuffix(name, ".") {
+		return libdns.Record{}, fmt.Errorf("%s does not belong into zone %s", ip, zone)
+	}
+	if !strings.HasSuffix(target, ".") {
+		target += "."
+	}
+	return libdns.Record{
+		Type:  "PTR",
+		Name:  relative,
+		Value: target,
+		TTL:   ttl,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package regfish_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseName(t *testing.T) {
+	assert.Equal(t, "1.2.0.192.in-addr.arpa.", regfish.ReverseName(net.ParseIP("192.0.2.1")))
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", regfish.ReverseName(net.ParseIP("2001:db8::1")))
+	assert.Equal(t, "", regfish.ReverseName(nil))
+}
+
+func TestReverseZone(t *testing.T) {
+	for cidr, want := range map[string]string{
+		"192.0.2.0/24":   "2.0.192.in-addr.arpa.",
+		"10.0.0.0/8":     "10.in-addr.arpa.",
+		"2001:db8::/32":  "8.b.d.0.1.0.0.2.ip6.arpa.",
+		"2001:db8::/36":  "0.8.b.d.0.1.0.0.2.ip6.arpa.",
+		"192.0.2.128/25": "",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		assert.Nil(t, err)
+		zone, err := regfish.ReverseZone(network)
+		if want == "" {
+			assert.NotNil(t, err, cidr)
+		} else {
+			assert.Nil(t, err, cidr)
+			assert.Equal(t, want, zone, cidr)
+		}
+	}
+}
+
+func TestPTRRecord(t *testing.T) {
+	record, err := regfish.PTRRecord(net.ParseIP("192.0.2.1"), "2.0.192.in-addr.arpa", "host.example.com", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, libdns.Record{Type: "PTR", Name: "1", Value: "host.example.com.", TTL: time.Hour}, record)
+	assert.Nil(t, regfish.ValidateRecord(record))
+
+	record, err = regfish.PTRRecord(net.ParseIP("2001:db8::1"), "8.b.d.0.1.0.0.2.ip6.arpa.", "host.example.com.", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0", record.Name)
+
+	_, err = regfish.PTRRecord(net.ParseIP("198.51.100.1"), "2.0.192.in-addr.arpa.", "host.example.com.", time.Hour)
+	assert.NotNil(t, err)
+}
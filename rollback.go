@@ -0,0 +1,117 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// changeLog records the changes a call of AppendRecords or SetRecords
+// makes to a zone, so that RollbackOnError can undo them if the call fails
+// part way.
+type changeLog struct {
+	original map[int]rfns.Record
+	logged   map[int]bool
+	created  []int
+	updated  []rfns.Record
+	deleted  []rfns.Record
+}
+
+// newChangeLog returns a changeLog for a zone holding existing records.
+func newChangeLog(existing []rfns.Record) *changeLog {
+	c := &changeLog{
+		original: make(map[int]rfns.Record, len(existing)),
+		logged:   make(map[int]bool),
+	}
+	for _, rec := range existing {
+		c.original[rec.ID] = rec
+	}
+	return c
+}
+
+// wrote logs that rec was created or updated. A record that existed
+// before is logged as updated, with its original state, only once.
+func (c *changeLog) wrote(rec rfns.Record) {
+	if rec.ID == 0 || c.logged[rec.ID] {
+		return
+	}
+	c.logged[rec.ID] = true
+	if original, ok := c.original[rec.ID]; ok {
+		c.updated = append(c.updated, original)
+	} else {
+		c.created = append(c.created, rec.ID)
+	}
+}
+
+// delete logs that rec was deleted.
+func (c *changeLog) delete(rec rfns.Record) {
+	c.deleted = append(c.deleted, rec)
+}
+
+// rollback undoes the changes logged in c as far as it can: deleted
+// records are created again, though with a new ID, updated records are
+// restored and created records are deleted. It goes on after a failure
+// and returns the first error.
+//
+// The rollback is not bound to ctx, which may have ended, only to its
+// values and WriteTimeout.
+func (p *Provider) rollback(ctx context.Context, c *changeLog) error {
+	ctx, cancel := withTimeout(detach(ctx), p.WriteTimeout)
+	defer cancel()
+
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, rec := range c.deleted {
+		rec.ID = 0
+		if _, err := p.createRecord(ctx, rec); err != nil {
+			fail(fmt.Errorf("failed to restore deleted record %s: %w", rec.Name, err))
+		}
+	}
+	for _, rec := range c.updated {
+		if _, err := p.updateRecord(ctx, rec.ID, rec); err != nil {
+			fail(fmt.Errorf("failed to restore record ID %d: %w", rec.ID, err))
+		}
+	}
+	for i := len(c.created) - 1; i >= 0; i-- {
+		if err := p.deleteRecord(ctx, c.created[i]); err != nil {
+			fail(fmt.Errorf("failed to delete created record ID %d: %w", c.created[i], err))
+		}
+	}
+	return firstErr
+}
+
+// rollbackError returns err, the error that made a call fail, together
+// with rerr, the error its rollback failed with, if any.
+func rollbackError(err, rerr error) error {
+	if rerr == nil {
+		return err
+	}
+	return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+}
+
+// detachedContext carries the values of a context, but not its deadline
+// or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+// detach returns a context with the values of ctx that does not end when
+// ctx ends.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
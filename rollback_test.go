@@ -0,0 +1,137 @@
+package regfish_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// failNth makes the nth request of the given method fail with a server
+// error that is not retried.
+func failNth(api *mockAPI, method string, n int) {
+	count := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method != method {
+			return 0, ""
+		}
+		count++
+		if count == n {
+			return http.StatusUnprocessableEntity, `{"message": "Record data is invalid"}`
+		}
+		return 0, ""
+	}
+}
+
+func TestAppendRecordsPartialFailure(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.1", TTL: time.Hour},
+		{Name: "b", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		{Name: "c", Type: "A", Value: "10.0.0.3", TTL: time.Hour},
+	}
+
+	t.Run("kept", func(t *testing.T) {
+		api := newMockAPI(t)
+		failNth(api, http.MethodPost, 3)
+
+		created, err := api.provider().AppendRecords(context.Background(), test_zone, records)
+		assert.NotNil(t, err)
+		assert.Len(t, created, 2)
+		assert.Len(t, api.snapshot(), 2)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		api := newMockAPI(t)
+		failNth(api, http.MethodPost, 3)
+		p := api.provider()
+		p.RollbackOnError = true
+
+		created, err := p.AppendRecords(context.Background(), test_zone, records)
+		assert.NotNil(t, err)
+		assert.Empty(t, created)
+		assert.Empty(t, api.snapshot())
+	})
+
+	t.Run("rollback failed", func(t *testing.T) {
+		api := newMockAPI(t)
+		count := 0
+		api.fail = func(r *http.Request) (int, string) {
+			if r.Method == http.MethodPost {
+				count++
+				if count == 3 {
+					return http.StatusUnprocessableEntity, `{"message": "Record data is invalid"}`
+				}
+			}
+			if r.Method == http.MethodDelete {
+				return http.StatusForbidden, `{"message": "access denied"}`
+			}
+			return 0, ""
+		}
+		p := api.provider()
+		p.RollbackOnError = true
+
+		created, err := p.AppendRecords(context.Background(), test_zone, records)
+		assert.ErrorContains(t, err, "rollback failed")
+		assert.Len(t, created, 2)
+	})
+}
+
+func TestSetRecordsPartialFailure(t *testing.T) {
+	existing := rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300}
+	records := []libdns.Record{
+		{Name: "a", Type: "A", Value: "10.0.0.9", TTL: time.Hour},
+		{Name: "b", Type: "A", Value: "10.0.0.2", TTL: time.Hour},
+		{Name: "c", Type: "A", Value: "10.0.0.3", TTL: time.Hour},
+	}
+
+	t.Run("kept", func(t *testing.T) {
+		api := newMockAPI(t, existing)
+		failNth(api, http.MethodPost, 2)
+
+		set, err := api.provider().SetRecords(context.Background(), test_zone, records)
+		assert.NotNil(t, err)
+		if assert.Len(t, set, 2) {
+			assert.Equal(t, "10.0.0.9", set[0].Value)
+			assert.Equal(t, "10.0.0.2", set[1].Value)
+		}
+		assert.Len(t, api.snapshot(), 2)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		api := newMockAPI(t, existing)
+		failNth(api, http.MethodPost, 2)
+		p := api.provider()
+		p.RollbackOnError = true
+
+		set, err := p.SetRecords(context.Background(), test_zone, records)
+		assert.NotNil(t, err)
+		assert.Empty(t, set)
+		live := api.snapshot()
+		if assert.Len(t, live, 1) {
+			assert.Equal(t, "10.0.0.1", live[0].Data)
+			assert.Equal(t, 300, live[0].TTL)
+		}
+	})
+
+	t.Run("replace record sets", func(t *testing.T) {
+		api := newMockAPI(t, existing,
+			rfns.Record{Name: "a.example.com.", Type: "A", Data: "10.0.0.5", TTL: 300},
+		)
+		failNth(api, http.MethodDelete, 1)
+		p := api.provider()
+		p.ReplaceRRsets = true
+		p.RollbackOnError = true
+
+		_, err := p.SetRecords(context.Background(), test_zone, records)
+		assert.NotNil(t, err)
+		var data []string
+		for _, rec := range api.snapshot() {
+			data = append(data, rec.Data)
+		}
+		assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.5"}, data)
+	})
+}
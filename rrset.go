@@ -0,0 +1,174 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// rrset is a record set of the zone that SetRecords replaces: the records
+// given for a name and type, by their position in the input, and the live
+// records of that name and type.
+type rrset struct {
+	given []int
+	live  []rfns.Record
+}
+
+// rrsetPlan is the plan of replaceRRsets. For each input record, target
+// holds -1 if the record exists unchanged, the ID of the live record to
+// update, or 0 if the record is to be created, and result holds the live
+// record if it exists unchanged.
+type rrsetPlan struct {
+	target  []int
+	result  []rfns.Record
+	deletes []rfns.Record
+}
+
+// planRRsets returns the writes needed to make the record sets of the
+// names and types of records hold exactly records. Live records are kept
+// where they exist unchanged, updated where they hold the same data, and
+// otherwise reused for the remaining records in order. Live records left
+// over are deleted.
+func planRRsets(index *recordIndex, records []libdns.Record, zone string) rrsetPlan {
+	plan := rrsetPlan{
+		target: make([]int, len(records)),
+		result: make([]rfns.Record, len(records)),
+	}
+
+	var keys []string
+	sets := make(map[string]*rrset)
+	for i, record := range records {
+		key := index.key(record.Name, record.Type)
+		set, ok := sets[key]
+		if !ok {
+			set = &rrset{live: index.lookup(record)}
+			sets[key] = set
+			keys = append(keys, key)
+		}
+		set.given = append(set.given, i)
+	}
+
+	for _, key := range keys {
+		set := sets[key]
+		used := make(map[int]bool)
+		matched := make(map[int]bool)
+
+		match := func(same func(rec rfns.Record, record libdns.Record) bool) {
+			for _, i := range set.given {
+				if matched[i] {
+					continue
+				}
+				for _, rec := range set.live {
+					if !used[rec.ID] && same(rec, records[i]) {
+						used[rec.ID] = true
+						matched[i] = true
+						plan.target[i] = rec.ID
+						if sameRecord(rec, records[i], zone) {
+							plan.target[i] = -1
+							plan.result[i] = rec
+						}
+						break
+					}
+				}
+			}
+		}
+		// First unchanged records, then records holding the same data,
+		// then any record of the set.
+		match(func(rec rfns.Record, record libdns.Record) bool {
+			return sameRecord(rec, record, zone)
+		})
+		match(func(rec rfns.Record, record libdns.Record) bool {
+			return len(index.matchData([]rfns.Record{rec}, record, true)) > 0
+		})
+		match(func(rfns.Record, libdns.Record) bool {
+			return true
+		})
+
+		for _, rec := range set.live {
+			if !used[rec.ID] {
+				plan.deletes = append(plan.deletes, rec)
+			}
+		}
+	}
+	return plan
+}
+
+// replaceRRsets makes the record sets of the names and types of records
+// hold exactly records, as SetRecords does with ReplaceRRsets set. It
+// returns the records written or found unchanged, in the order of records,
+// and reports whether anything was written. Records are created and
+// updated before surplus records are deleted, so that a record set is not
+// left empty midway. All changes are logged to changes. If it fails part
+// way, it returns those of the records before the failing one.
+func (p *Provider) replaceRRsets(ctx context.Context, index *recordIndex, changes *changeLog, records []libdns.Record, zone string) ([]rfns.Record, bool, error) {
+	plan := planRRsets(index, records, zone)
+
+	deleted := make(map[int]bool, len(plan.deletes))
+	for _, rec := range plan.deletes {
+		deleted[rec.ID] = true
+	}
+	var live []rfns.Record
+	for _, rec := range index.records {
+		if !deleted[rec.ID] {
+			live = append(live, rec)
+		}
+	}
+	var created []libdns.Record
+	for i, record := range records {
+		if plan.target[i] == 0 {
+			created = append(created, record)
+		}
+	}
+	if err := p.checkRecordsPerName(live, created, zone); err != nil {
+		return nil, false, err
+	}
+
+	if !forceDelete(ctx) {
+		for _, rec := range plan.deletes {
+			if isProtected(rec.Name, rec.Type, zone) {
+				return nil, false, protectedError(rec.Type, zone)
+			}
+		}
+		if err := checkGlue(index.records, deleted, zone); err != nil {
+			return nil, false, err
+		}
+	}
+
+	written := false
+	for i, record := range records {
+		if plan.target[i] < 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return plan.result[:i], written, fmt.Errorf("failed to update record %s: %w", record.Name, err)
+		}
+		written = true
+
+		rec := convertFromLibdnsRecord(record, zone)
+		var err error
+		if plan.target[i] > 0 {
+			plan.result[i], err = p.updateRecord(ctx, plan.target[i], rec)
+		} else {
+			plan.result[i], err = p.createRecord(ctx, rec)
+		}
+		changes.wrote(plan.result[i])
+		if err != nil {
+			return plan.result[:i], written, fmt.Errorf("failed to update record %s: %w", record.Name, err)
+		}
+	}
+
+	for _, rec := range plan.deletes {
+		if err := ctx.Err(); err != nil {
+			return plan.result, written, fmt.Errorf("failed to delete record ID %d: %w", rec.ID, err)
+		}
+		written = true
+		if err := p.deleteRecord(ctx, rec.ID); err != nil {
+			return plan.result, written, fmt.Errorf("failed to delete record ID %d: %w", rec.ID, err)
+		}
+		changes.delete(rec)
+	}
+
+	return plan.result, written, nil
+}
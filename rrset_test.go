@@ -0,0 +1,66 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceRRsets(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{ID: 2, Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{ID: 3, Name: "www.example.com.", Type: "A", Data: "10.0.0.3", TTL: 300},
+		rfns.Record{ID: 4, Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		rfns.Record{ID: 5, Name: "_acme-challenge.example.com.", Type: "TXT", Data: "old", TTL: 300},
+	)
+	p := api.provider()
+	p.ReplaceRRsets = true
+
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+		{Name: "_acme-challenge", Type: "TXT", Value: "new", TTL: time.Minute},
+		{Name: "_acme-challenge", Type: "TXT", Value: "other", TTL: time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "2", Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+		{ID: "5", Name: "_acme-challenge", Type: "TXT", Value: "new", TTL: time.Minute},
+		{ID: "1001", Name: "_acme-challenge", Type: "TXT", Value: "other", TTL: time.Minute},
+	}, result)
+
+	// The unchanged A record is kept as is, the others of its set are
+	// deleted, and the AAAA record is left alone.
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/2"))
+	assert.Equal(t, 1, api.count("DELETE /dns/rr/1"))
+	assert.Equal(t, 1, api.count("DELETE /dns/rr/3"))
+	assert.Equal(t, []rfns.Record{
+		{ID: 2, Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		{ID: 4, Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		{ID: 5, Name: "_acme-challenge.example.com.", Type: "TXT", Data: "new", TTL: 60},
+		{ID: 1001, Name: "_acme-challenge.example.com.", Type: "TXT", Data: "other", TTL: 60},
+	}, api.snapshot())
+}
+
+func TestReplaceRRsetsProtected(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{ID: 1, Name: "example.com.", Type: "NS", Data: "ns1.regfish.de.", TTL: 3600},
+		rfns.Record{ID: 2, Name: "example.com.", Type: "NS", Data: "ns2.regfish.net.", TTL: 3600},
+	)
+	p := api.provider()
+	p.ReplaceRRsets = true
+	records := []libdns.Record{{Name: "", Type: "NS", Value: "ns1.regfish.de.", TTL: time.Hour}}
+
+	_, err := p.SetRecords(context.Background(), test_zone, records)
+	assert.ErrorIs(t, err, regfish.ErrProtectedRecord)
+	assert.Len(t, api.snapshot(), 2)
+
+	_, err = p.SetRecords(regfish.WithForceDelete(context.Background()), test_zone, records)
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 1)
+}
@@ -0,0 +1,116 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// GetZoneModified returns when the zone was last changed, derived from the
+// serial of its SOA record, which regfish increments with every change.
+// The regfish API has no modification time of its own. Serials in the
+// common YYYYMMDDnn form give the day of the change, at midnight UTC;
+// serials holding a Unix timestamp give the exact time. Other serials
+// carry no time and yield an error; compare them with ZoneHash instead.
+func (p *Provider) GetZoneModified(ctx context.Context, zone string) (time.Time, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	soa, err := findSOA(records, zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return serialTime(soa.Serial)
+}
+
+// SOA is the parsed value of the SOA record of a zone. regfish maintains
+// the SOA record itself, so the Provider only reads it.
+type SOA struct {
+	// MName is the primary name server of the zone.
+	MName string
+
+	// RName is the mailbox of the person responsible for the zone, with
+	// the "@" replaced by a dot.
+	RName string
+
+	// Serial is the version of the zone, which regfish increments with
+	// every change.
+	Serial uint32
+
+	Refresh time.Duration
+	Retry   time.Duration
+	Expire  time.Duration
+
+	// Minimum is how long resolvers cache negative answers for names in
+	// the zone.
+	Minimum time.Duration
+}
+
+// GetSOA returns the SOA record of the zone, such as to inspect its serial
+// or negative caching TTL.
+func (p *Provider) GetSOA(ctx context.Context, zone string) (SOA, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return SOA{}, err
+	}
+	return findSOA(records, zone)
+}
+
+// findSOA returns the parsed SOA record at the apex among records of zone.
+func findSOA(records []libdns.Record, zone string) (SOA, error) {
+	for _, record := range records {
+		if strings.EqualFold(record.Type, "SOA") && normalizeName(record.Name) == "" {
+			return ParseSOA(record.Value)
+		}
+	}
+	return SOA{}, fmt.Errorf("zone %s has no SOA record", zone)
+}
+
+// ParseSOA parses the value of a SOA record,
+// "<mname> <rname> <serial> <refresh> <retry> <expire> <minimum>", with
+// the times in seconds.
+func ParseSOA(value string) (SOA, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 7 {
+		return SOA{}, fmt.Errorf("malformed SOA value %q", value)
+	}
+
+	var numbers [5]uint32
+	for i, name := range []string{"serial", "refresh", "retry", "expire", "minimum"} {
+		n, err := strconv.ParseUint(fields[2+i], 10, 32)
+		if err != nil {
+			return SOA{}, fmt.Errorf("invalid SOA %s %s: %v", name, fields[2+i], err)
+		}
+		numbers[i] = uint32(n)
+	}
+
+	return SOA{
+		MName:   fields[0],
+		RName:   fields[1],
+		Serial:  numbers[0],
+		Refresh: time.Duration(numbers[1]) * time.Second,
+		Retry:   time.Duration(numbers[2]) * time.Second,
+		Expire:  time.Duration(numbers[3]) * time.Second,
+		Minimum: time.Duration(numbers[4]) * time.Second,
+	}, nil
+}
+
+// serialTime returns the time a SOA serial denotes.
+func serialTime(serial uint32) (time.Time, error) {
+	s := strconv.FormatUint(uint64(serial), 10)
+	if len(s) == 10 {
+		if t, err := time.Parse("20060102", s[:8]); err == nil && t.Year() >= 1970 {
+			return t, nil
+		}
+	}
+	if serial >= 1e9 {
+		return time.Unix(int64(serial), 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("SOA serial %d holds no date", serial)
+}
@@ -0,0 +1,79 @@
+package regfish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetZoneModified(t *testing.T) {
+	tests := []struct {
+		serial string
+		want   time.Time
+	}{
+		{"2024031502", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"1718000000", time.Unix(1718000000, 0).UTC()},
+	}
+
+	for _, tt := range tests {
+		api := newMockAPI(t,
+			rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+			rfns.Record{Name: "example.com.", Type: "SOA", Data: "ns1.regfish.de. hostmaster.regfish.de. " + tt.serial + " 3600 900 604800 300", TTL: 86400},
+		)
+
+		modified, err := api.provider().GetZoneModified(context.Background(), test_zone)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, modified, "serial %s", tt.serial)
+	}
+}
+
+func TestGetZoneModifiedNoDate(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "SOA", Data: "ns1.regfish.de. hostmaster.regfish.de. 42 3600 900 604800 300", TTL: 86400},
+	)
+	_, err := api.provider().GetZoneModified(context.Background(), test_zone)
+	assert.Error(t, err)
+
+	api = newMockAPI(t)
+	_, err = api.provider().GetZoneModified(context.Background(), test_zone)
+	assert.Error(t, err)
+}
+
+func TestGetSOA(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "example.com.", Type: "SOA", Data: "ns1.regfish.de. hostmaster.regfish.de. 2024031502 3600 900 604800 300", TTL: 86400},
+	)
+	p := api.provider()
+	p.ApexAt = true
+
+	soa, err := p.GetSOA(context.Background(), test_zone)
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.SOA{
+		MName:   "ns1.regfish.de.",
+		RName:   "hostmaster.regfish.de.",
+		Serial:  2024031502,
+		Refresh: time.Hour,
+		Retry:   15 * time.Minute,
+		Expire:  7 * 24 * time.Hour,
+		Minimum: 5 * time.Minute,
+	}, soa)
+
+	_, err = regfish.ParseSOA("ns1.regfish.de. hostmaster.regfish.de. 1 3600 900 604800 -1")
+	assert.ErrorContains(t, err, "invalid SOA minimum")
+}
+
+func TestWriteSOA(t *testing.T) {
+	api := newMockAPI(t)
+	soa := libdns.Record{Name: "", Type: "SOA", Value: "ns1.example.net. hostmaster.example.net. 1 3600 900 604800 300", TTL: time.Hour}
+
+	_, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{soa})
+	assert.ErrorContains(t, err, "maintained by regfish")
+	_, err = api.provider().SetRecords(context.Background(), test_zone, []libdns.Record{soa})
+	assert.ErrorContains(t, err, "maintained by regfish")
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+}
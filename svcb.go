@@ -0,0 +1,258 @@
+package regfish
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ServiceBinding is the parsed form of an HTTPS or SVCB record.
+type ServiceBinding struct {
+	// Scheme is "https" for HTTPS records and empty for SVCB records.
+	Scheme string
+
+	// Priority is 0 for a record in alias mode, which points to Target
+	// and has no parameters, and 1 or more in service mode.
+	Priority uint16
+
+	// Target is the target name, or "." for the owner name of the record
+	// in service mode.
+	Target string
+
+	Params SvcParams
+}
+
+// AliasMode reports whether the record is in alias mode.
+func (b ServiceBinding) AliasMode() bool {
+	return b.Priority == 0
+}
+
+// Record returns b as a record with the given name and TTL, in the form
+// the Provider reads and writes HTTPS and SVCB records: the priority in
+// Priority and the target and parameters in Value.
+func (b ServiceBinding) Record(name string, ttl time.Duration) libdns.Record {
+	recordType := "SVCB"
+	if b.Scheme == "https" {
+		recordType = "HTTPS"
+	}
+	value := b.Target
+	if params := b.Params.String(); params != "" {
+		value += " " + params
+	}
+	return libdns.Record{
+		Type:     recordType,
+		Name:     name,
+		Value:    value,
+		TTL:      ttl,
+		Priority: int(b.Priority),
+	}
+}
+
+// ParseServiceBinding parses an HTTPS or SVCB record as the Provider
+// returns it, such as one with priority 1 and the value
+// `. alpn=h2,h3 ipv4hint=192.0.2.1`. A priority in front of the value, as
+// in zone file form, is accepted if Priority is not set.
+func ParseServiceBinding(record libdns.Record) (ServiceBinding, error) {
+	var b ServiceBinding
+	switch strings.ToUpper(record.Type) {
+	case "HTTPS":
+		b.Scheme = "https"
+	case "SVCB":
+	default:
+		return ServiceBinding{}, fmt.Errorf("record %s of type %s is no HTTPS or SVCB record", record.Name, record.Type)
+	}
+
+	priority, data := splitPriority(record)
+	if priority < 0 || priority > 65535 {
+		return ServiceBinding{}, fmt.Errorf("invalid %s priority %d", record.Type, priority)
+	}
+	b.Priority = uint16(priority)
+
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return ServiceBinding{}, fmt.Errorf("malformed %s value %q: missing target", record.Type, record.Value)
+	}
+	target, rest := data, ""
+	if i := strings.IndexAny(data, " \t"); i >= 0 {
+		target, rest = data[:i], data[i+1:]
+	}
+	if strings.Contains(target, "=") {
+		return ServiceBinding{}, fmt.Errorf("malformed %s value %q: missing target", record.Type, record.Value)
+	}
+	b.Target = target
+
+	params, err := ParseSvcParams(rest)
+	if err != nil {
+		return ServiceBinding{}, err
+	}
+	b.Params = params
+	return b, nil
+}
+
+// SvcParams are the parameters of an HTTPS or SVCB record, keyed by their
+// name, such as "alpn" or "ipv4hint", with their comma-separated values.
+// Keys without a value, such as "no-default-alpn", have no values.
+type SvcParams map[string][]string
+
+// svcParamKeys are the numbers of the registered SvcParamKeys, which
+// order the parameters in String.
+var svcParamKeys = map[string]int{
+	"mandatory":       0,
+	"alpn":            1,
+	"no-default-alpn": 2,
+	"port":            3,
+	"ipv4hint":        4,
+	"ech":             5,
+	"ipv6hint":        6,
+	"dohpath":         7,
+	"ohttp":           8,
+}
+
+// svcParamKey returns the number of a SvcParamKey given by name or in the
+// generic form "keyNNNNN", or -1 if it has neither.
+func svcParamKey(key string) int {
+	if n, ok := svcParamKeys[key]; ok {
+		return n
+	}
+	if strings.HasPrefix(key, "key") {
+		if n, err := strconv.ParseUint(key[3:], 10, 16); err == nil {
+			return int(n)
+		}
+	}
+	return -1
+}
+
+// ParseSvcParams parses the parameters of an HTTPS or SVCB record, such
+// as `alpn=h2,h3 ipv4hint=192.0.2.1`. Values may be quoted.
+func ParseSvcParams(s string) (SvcParams, error) {
+	params := make(SvcParams)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		i := strings.IndexAny(s, "= \t")
+		if i < 0 {
+			i = len(s)
+		}
+		key := s[:i]
+		s = s[i:]
+		if key == "" {
+			return nil, fmt.Errorf("malformed SvcParams: empty key")
+		}
+		if _, ok := params[key]; ok {
+			return nil, fmt.Errorf("malformed SvcParams: duplicate key %s", key)
+		}
+
+		if !strings.HasPrefix(s, "=") {
+			params[key] = nil
+			continue
+		}
+		s = s[1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("malformed SvcParams: unterminated quote in value of %s", key)
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		params[key] = strings.Split(value, ",")
+	}
+	return params, nil
+}
+
+// String returns the parameters in presentation format, ordered by their
+// key numbers, with unknown keys last in alphabetical order.
+func (p SvcParams) String() string {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := svcParamKey(keys[i]), svcParamKey(keys[j])
+		if (a < 0) != (b < 0) {
+			return a >= 0
+		}
+		if a != b {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := p[key]
+		if len(values) == 0 {
+			parts = append(parts, key)
+			continue
+		}
+		value := strings.Join(values, ",")
+		if strings.ContainsAny(value, " \t") {
+			value = `"` + value + `"`
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// validate checks the parameters of b for values that cannot be encoded:
+// a port that is no 16-bit number, hints that are no addresses of their
+// family, keys that take values without any or the reverse, and mandatory
+// keys that are missing. A record in alias mode must have no parameters.
+func (b ServiceBinding) validate() error {
+	if b.AliasMode() && len(b.Params) > 0 {
+		return fmt.Errorf("record in alias mode has parameters")
+	}
+	for key, values := range b.Params {
+		if svcParamKey(key) < 0 {
+			return fmt.Errorf("unknown SvcParamKey %s", key)
+		}
+		switch key {
+		case "no-default-alpn":
+			if len(values) > 0 {
+				return fmt.Errorf("SvcParam %s takes no value", key)
+			}
+			continue
+		case "mandatory", "alpn", "port", "ipv4hint", "ipv6hint", "ech", "dohpath":
+			if len(values) == 0 {
+				return fmt.Errorf("SvcParam %s needs a value", key)
+			}
+		}
+		for _, value := range values {
+			var ok bool
+			switch key {
+			case "port":
+				ok = len(values) == 1 && isUint16(value)
+			case "ipv4hint":
+				ip := net.ParseIP(value)
+				ok = ip != nil && ip.To4() != nil
+			case "ipv6hint":
+				ok = net.ParseIP(value) != nil && strings.Contains(value, ":")
+			case "mandatory":
+				_, listed := b.Params[value]
+				ok = listed && value != "mandatory"
+			default:
+				ok = true
+			}
+			if !ok {
+				return fmt.Errorf("invalid value %q of SvcParam %s", value, key)
+			}
+		}
+	}
+	return nil
+}
+
+// isUint16 reports whether s is a decimal number between 0 and 65535.
+func isUint16(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
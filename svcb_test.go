@@ -0,0 +1,80 @@
+package regfish_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceBindingRoundTrip(t *testing.T) {
+	record := libdns.Record{Name: "www", Type: "HTTPS", Value: ". alpn=h2,h3 ipv4hint=192.0.2.1,192.0.2.2", TTL: time.Hour, Priority: 1}
+
+	rec := regfish.FromLibdnsRecord(record, "example.com.")
+	assert.Equal(t, "www.example.com.", rec.Name)
+	assert.Equal(t, ". alpn=h2,h3 ipv4hint=192.0.2.1,192.0.2.2", rec.Data)
+	if assert.NotNil(t, rec.Priority) {
+		assert.Equal(t, 1, *rec.Priority)
+	}
+
+	read := regfish.ToLibdnsRecord(rec, "example.com.")
+	assert.Equal(t, record, read)
+
+	b, err := regfish.ParseServiceBinding(read)
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.ServiceBinding{
+		Scheme:   "https",
+		Priority: 1,
+		Target:   ".",
+		Params: regfish.SvcParams{
+			"alpn":     {"h2", "h3"},
+			"ipv4hint": {"192.0.2.1", "192.0.2.2"},
+		},
+	}, b)
+	assert.False(t, b.AliasMode())
+	assert.Equal(t, record, b.Record("www", time.Hour))
+}
+
+func TestServiceBindingAliasMode(t *testing.T) {
+	b, err := regfish.ParseServiceBinding(libdns.Record{Type: "HTTPS", Value: "cdn.example.net."})
+	assert.Nil(t, err)
+	assert.True(t, b.AliasMode())
+	assert.Equal(t, "cdn.example.net.", b.Target)
+	assert.Empty(t, b.Params)
+
+	record := b.Record("", time.Hour)
+	assert.Equal(t, libdns.Record{Type: "HTTPS", Value: "cdn.example.net.", TTL: time.Hour}, record)
+	if rec := regfish.FromLibdnsRecord(record, "example.com."); assert.NotNil(t, rec.Priority) {
+		assert.Equal(t, 0, *rec.Priority)
+	}
+}
+
+func TestParseServiceBinding(t *testing.T) {
+	b, err := regfish.ParseServiceBinding(libdns.Record{Type: "SVCB", Value: `2 dns.example.net. no-default-alpn alpn=dot port=853 dohpath="/q{?dns}"`})
+	assert.Nil(t, err)
+	assert.Equal(t, regfish.ServiceBinding{
+		Priority: 2,
+		Target:   "dns.example.net.",
+		Params: regfish.SvcParams{
+			"no-default-alpn": nil,
+			"alpn":            {"dot"},
+			"port":            {"853"},
+			"dohpath":         {"/q{?dns}"},
+		},
+	}, b)
+	assert.Equal(t, "alpn=dot no-default-alpn port=853 dohpath=/q{?dns}", b.Params.String())
+
+	for _, record := range []libdns.Record{
+		{Type: "A", Value: "192.0.2.1"},
+		{Type: "HTTPS", Priority: 1},
+		{Type: "HTTPS", Priority: 1, Value: "alpn=h2"},
+		{Type: "HTTPS", Priority: 1, Value: ". alpn=h2 alpn=h3"},
+		{Type: "HTTPS", Priority: 1, Value: `. dohpath="/q`},
+		{Type: "HTTPS", Priority: 70000, Value: "."},
+	} {
+		_, err := regfish.ParseServiceBinding(record)
+		assert.Error(t, err, "%+v", record)
+	}
+}
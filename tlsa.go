@@ -0,0 +1,112 @@
+package regfish
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// TLSA is the parsed value of a TLSA record, which associates a TLS
+// certificate or public key with a service for DANE.
+type TLSA struct {
+	// Usage is the certificate usage: 0 (PKIX-TA), 1 (PKIX-EE), 2
+	// (DANE-TA) or 3 (DANE-EE).
+	Usage uint8
+
+	// Selector is 0 if Data matches the full certificate and 1 if it
+	// matches the public key only.
+	Selector uint8
+
+	// MatchingType is 0 if Data holds the selected content as is, 1 if
+	// it holds its SHA-256 and 2 if it holds its SHA-512 hash.
+	MatchingType uint8
+
+	// Data is the certificate association data.
+	Data []byte
+}
+
+// ParseTLSA parses the value of a TLSA record, such as
+// "3 1 1 0D6FCE13...". The association data may be split by spaces and in
+// either case.
+func ParseTLSA(value string) (TLSA, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return TLSA{}, fmt.Errorf("malformed TLSA value %q; expected: '<usage> <selector> <matching type> <data>'", value)
+	}
+
+	var numbers [3]uint8
+	for i, name := range []string{"usage", "selector", "matching type"} {
+		n, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return TLSA{}, fmt.Errorf("invalid TLSA %s %s: %v", name, fields[i], err)
+		}
+		numbers[i] = uint8(n)
+	}
+	data, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return TLSA{}, fmt.Errorf("invalid TLSA data: %v", err)
+	}
+
+	return TLSA{
+		Usage:        numbers[0],
+		Selector:     numbers[1],
+		MatchingType: numbers[2],
+		Data:         data,
+	}, nil
+}
+
+// String returns the value of the TLSA record, with the association data
+// in uppercase hex.
+func (t TLSA) String() string {
+	return fmt.Sprintf("%d %d %d %s", t.Usage, t.Selector, t.MatchingType, strings.ToUpper(hex.EncodeToString(t.Data)))
+}
+
+// Record returns t as a TLSA record with the given name, such as one
+// returned by TLSAName, and TTL.
+func (t TLSA) Record(name string, ttl time.Duration) libdns.Record {
+	return libdns.Record{
+		Type:  "TLSA",
+		Name:  name,
+		Value: t.String(),
+		TTL:   ttl,
+	}
+}
+
+// validate checks that the fields of t have assigned values, counting 255
+// as private use, and that hashes have the length of their matching type.
+func (t TLSA) validate() error {
+	if t.Usage > 3 && t.Usage != 255 {
+		return fmt.Errorf("unknown TLSA usage %d", t.Usage)
+	}
+	if t.Selector > 1 && t.Selector != 255 {
+		return fmt.Errorf("unknown TLSA selector %d", t.Selector)
+	}
+	switch t.MatchingType {
+	case 0, 255:
+	case 1, 2:
+		if size := 32 * int(t.MatchingType); len(t.Data) != size {
+			return fmt.Errorf("TLSA data of matching type %d has %d bytes instead of %d", t.MatchingType, len(t.Data), size)
+		}
+	default:
+		return fmt.Errorf("unknown TLSA matching type %d", t.MatchingType)
+	}
+	if len(t.Data) == 0 {
+		return fmt.Errorf("TLSA data is empty")
+	}
+	return nil
+}
+
+// TLSAName returns the name of the TLSA record of a service, such as
+// "_443._tcp.www" for HTTPS on host "www", relative to the zone of host.
+// An empty host stands for the zone apex.
+func TLSAName(port uint16, protocol, host string) string {
+	name := fmt.Sprintf("_%d._%s", port, strings.ToLower(protocol))
+	if host != "" && host != "@" {
+		name += "." + host
+	}
+	return name
+}
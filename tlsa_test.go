@@ -0,0 +1,72 @@
+package regfish_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTLSAHash = "0d6fce13243aa7b5a5e16e4a1d5e9b5a8e1f1e2c3b4a5d6e7f8091a2b3c4d5e6"
+
+func TestParseTLSA(t *testing.T) {
+	tlsa, err := regfish.ParseTLSA("3 1 1 " + testTLSAHash[:32] + " " + testTLSAHash[32:])
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(3), tlsa.Usage)
+	assert.Equal(t, uint8(1), tlsa.Selector)
+	assert.Equal(t, uint8(1), tlsa.MatchingType)
+	assert.Len(t, tlsa.Data, 32)
+	assert.Equal(t, "3 1 1 "+strings.ToUpper(testTLSAHash), tlsa.String())
+
+	assert.Equal(t, libdns.Record{Type: "TLSA", Name: "_443._tcp.www", Value: tlsa.String(), TTL: time.Hour},
+		tlsa.Record(regfish.TLSAName(443, "TCP", "www"), time.Hour))
+	assert.Equal(t, "_25._tcp", regfish.TLSAName(25, "tcp", "@"))
+
+	for _, value := range []string{"3 1 1", "3 1 x " + testTLSAHash, "3 1 1 zz", "256 1 1 " + testTLSAHash} {
+		_, err := regfish.ParseTLSA(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestValidateTLSA(t *testing.T) {
+	for value, want := range map[string]string{
+		"3 1 1 " + testTLSAHash:      "",
+		"2 0 0 308201":               "",
+		"3 1 2 " + testTLSAHash:      "instead of 64",
+		"4 1 1 " + testTLSAHash:      "unknown TLSA usage",
+		"3 1 3 " + testTLSAHash:      "unknown TLSA matching type",
+		"3 1 1 " + testTLSAHash[:10]: "instead of 32",
+	} {
+		err := regfish.ValidateRecord(libdns.Record{Type: "TLSA", Name: "_443._tcp", Value: value})
+		if want == "" {
+			assert.Nil(t, err, value)
+		} else {
+			assert.ErrorContains(t, err, want, value)
+		}
+	}
+}
+
+func TestSetRecordsTLSA(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "_443._tcp.example.com.", Type: "TLSA", Data: "3 1 1 " + testTLSAHash, TTL: 300},
+		rfns.Record{Name: "_443._tcp.example.com.", Type: "TLSA", Data: "3 1 1 " + strings.Repeat("ab", 32), TTL: 300},
+	)
+	p := api.provider()
+
+	// The record given in another case and split differently is the
+	// first one, which is updated instead of the ambiguous set failing.
+	result, err := p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "_443._tcp", Type: "TLSA", Value: "3 1 1 " + strings.ToUpper(testTLSAHash[:20]) + " " + testTLSAHash[20:], TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "1001", result[0].ID)
+		assert.Equal(t, "3 1 1 "+strings.ToUpper(testTLSAHash), result[0].Value)
+	}
+	assert.Len(t, api.snapshot(), 2)
+}
@@ -0,0 +1,197 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// RotateTXT replaces the value oldValue of the TXT records at name with
+// newValue, for example during a key rollover, without a moment where
+// neither value is published. If the old value is the only TXT record at
+// name, it is updated in place; otherwise the new value is added first and
+// the old one removed afterwards. The new value keeps the TTL of the old
+// one. It returns the record holding the new value.
+func (p *Provider) RotateTXT(ctx context.Context, zone, name, oldValue, newValue string) (libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return libdns.Record{}, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return libdns.Record{}, err
+	}
+
+	zone, err = p.toAPIName(zone)
+	if err != nil {
+		return libdns.Record{}, err
+	}
+	if name, err = p.toAPIName(name); err != nil {
+		return libdns.Record{}, err
+	}
+	defer p.invalidateCache(zone)
+
+	records, err := p.getRecords(ctx, zone)
+	if err != nil {
+		return libdns.Record{}, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+
+	var txt []rfns.Record
+	var oldRec, newRec *rfns.Record
+	for i, rec := range records {
+		if !sameName(rec.Name, name, zone) || !strings.EqualFold(rec.Type, "TXT") {
+			continue
+		}
+		txt = append(txt, rec)
+		switch joinTXT(rec.Data) {
+		case oldValue:
+			oldRec = &records[i]
+		case newValue:
+			newRec = &records[i]
+		}
+	}
+
+	if oldRec == nil {
+		return libdns.Record{}, fmt.Errorf("TXT record %s with data %s not found", name, p.errorData("TXT", oldValue))
+	}
+
+	if newRec == nil && len(txt) == 1 {
+		update := *oldRec
+		update.Data = chunkTXT(newValue)
+		updated, err := p.updateRecord(ctx, oldRec.ID, update)
+		if err != nil {
+			return libdns.Record{}, fmt.Errorf("failed to update TXT record %s: %w", name, err)
+		}
+		return p.fromAPI([]libdns.Record{convertToLibdnsRecord(updated, zone)})[0], nil
+	}
+
+	if newRec == nil {
+		create := *oldRec
+		create.ID = 0
+		create.Data = chunkTXT(newValue)
+		created, err := p.createRecord(ctx, create)
+		if err != nil {
+			return libdns.Record{}, fmt.Errorf("failed to create TXT record %s: %w", name, err)
+		}
+		newRec = &created
+	}
+
+	if err := p.deleteRecord(ctx, oldRec.ID); err != nil {
+		return libdns.Record{}, fmt.Errorf("failed to delete record ID %d: %w", oldRec.ID, err)
+	}
+
+	return p.fromAPI([]libdns.Record{convertToLibdnsRecord(*newRec, zone)})[0], nil
+}
+
+// maxTXTChunk is the maximum length of a single character-string in a TXT
+// record.
+const maxTXTChunk = 255
+
+// chunkTXT splits a TXT value longer than a single character-string may be
+// into quoted character-strings of at most 255 bytes each, separated by
+// spaces, e.g. a DKIM key into "v=DKIM1; k=rsa; p=..." "...". Values that
+// fit into one character-string are returned as is, as are values that
+// are already quoted character-strings of at most 255 bytes each. Quoted
+// character-strings that are longer are joined and split anew, and other
+// values starting with a quote, such as one never closed, are quoted as a
+// whole. Multi-byte characters are never split.
+func chunkTXT(value string) string {
+	if !strings.HasPrefix(value, `"`) {
+		if len(value) <= maxTXTChunk {
+			return value
+		}
+	} else if strs, err := splitCharacterStrings(value); err == nil {
+		if fitCharacterStrings(strs) {
+			return value
+		}
+		value = strings.Join(strs, "")
+	}
+
+	var chunks []string
+	for len(value) > 0 {
+		n := len(value)
+		if n > maxTXTChunk {
+			n = maxTXTChunk
+			for n > 0 && !utf8.RuneStart(value[n]) {
+				n--
+			}
+		}
+		chunks = append(chunks, quoteCharacterString(value[:n]))
+		value = value[n:]
+	}
+	return strings.Join(chunks, " ")
+}
+
+// joinTXT undoes chunkTXT: a quoted TXT value, as regfish returns long
+// values, is unquoted and its character-strings joined into the one
+// string they make up, the way resolvers join them. A single quoted
+// character-string is unquoted the same way. Unquoted values are returned
+// as is.
+func joinTXT(value string) string {
+	if !strings.HasPrefix(strings.TrimSpace(value), `"`) {
+		return value
+	}
+	strs, err := splitCharacterStrings(value)
+	if err != nil {
+		return value
+	}
+	return strings.Join(strs, "")
+}
+
+// splitCharacterStrings splits value into its character-strings, which
+// are separated by whitespace and may be quoted, such as
+// `"Intel x86" Linux`. Within quotes, a backslash escapes the next
+// character.
+func splitCharacterStrings(value string) ([]string, error) {
+	var strs []string
+	for value = strings.TrimSpace(value); value != ""; value = strings.TrimSpace(value) {
+		if value[0] != '"' {
+			end := strings.IndexAny(value, " \t")
+			if end < 0 {
+				end = len(value)
+			}
+			strs = append(strs, value[:end])
+			value = value[end:]
+			continue
+		}
+
+		var b strings.Builder
+		i := 1
+		for ; i < len(value) && value[i] != '"'; i++ {
+			if value[i] == '\\' && i+1 < len(value) {
+				i++
+			}
+			b.WriteByte(value[i])
+		}
+		if i == len(value) {
+			return nil, fmt.Errorf("unterminated quote in %q", value)
+		}
+		strs = append(strs, b.String())
+		value = value[i+1:]
+	}
+	return strs, nil
+}
+
+// fitCharacterStrings reports whether none of strs is longer than a
+// character-string may be.
+func fitCharacterStrings(strs []string) bool {
+	for _, s := range strs {
+		if len(s) > maxTXTChunk {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteCharacterString returns s as a quoted character-string, escaping
+// quotes and backslashes.
+func quoteCharacterString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,208 @@
+package regfish_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateTXT(t *testing.T) {
+	t.Run("Single record is updated in place", func(t *testing.T) {
+		api := newMockAPI(t,
+			rfns.Record{ID: 1, Name: "_domainkey.example.com.", Type: "TXT", Data: "old-key", TTL: 3600},
+		)
+
+		result, err := api.provider().RotateTXT(context.Background(), test_zone, "_domainkey", "old-key", "new-key")
+		assert.Nil(t, err)
+		assert.Equal(t, "new-key", result.Value)
+		assert.Equal(t, "1", result.ID)
+		assert.Equal(t, 1, api.count("PATCH /dns/rr/1"))
+		assert.Equal(t, 0, api.count("DELETE /dns/rr/1"))
+
+		if stored := api.snapshot(); assert.Len(t, stored, 1) {
+			assert.Equal(t, "new-key", stored[0].Data)
+			assert.Equal(t, 3600, stored[0].TTL)
+		}
+	})
+
+	t.Run("New value is added before the old one is removed", func(t *testing.T) {
+		api := newMockAPI(t,
+			rfns.Record{ID: 1, Name: "_domainkey.example.com.", Type: "TXT", Data: "old-key", TTL: 3600},
+			rfns.Record{ID: 2, Name: "_domainkey.example.com.", Type: "TXT", Data: "other", TTL: 3600},
+		)
+
+		var sawNew bool
+		api.before = func(r *http.Request) {
+			if r.Method != http.MethodDelete {
+				return
+			}
+			for _, rec := range api.snapshot() {
+				if rec.Data == "new-key" {
+					sawNew = true
+				}
+			}
+		}
+
+		result, err := api.provider().RotateTXT(context.Background(), test_zone, "_domainkey", "old-key", "new-key")
+		assert.Nil(t, err)
+		assert.Equal(t, "new-key", result.Value)
+		assert.Equal(t, 3600, int(result.TTL.Seconds()))
+		assert.True(t, sawNew, "new value was not published before the old one was deleted")
+
+		var values []string
+		for _, rec := range api.snapshot() {
+			values = append(values, rec.Data)
+		}
+		assert.ElementsMatch(t, []string{"other", "new-key"}, values)
+	})
+
+	t.Run("Old value not found", func(t *testing.T) {
+		api := newMockAPI(t)
+		_, err := api.provider().RotateTXT(context.Background(), test_zone, "_domainkey", "old-key", "new-key")
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestAppendLongTXT(t *testing.T) {
+	api := newMockAPI(t)
+	value := strings.Repeat("0123456789", 100)
+
+	_, err := api.provider().AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "long", Type: "TXT", Value: value, TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+
+	stored := api.snapshot()
+	if assert.Len(t, stored, 1) {
+		chunks := strings.Split(stored[0].Data, " ")
+		if assert.Len(t, chunks, 4) {
+			assert.Equal(t, `"`+value[:255]+`"`, chunks[0])
+			assert.Equal(t, `"`+value[765:]+`"`, chunks[3])
+		}
+		assert.Equal(t, value, strings.ReplaceAll(strings.ReplaceAll(stored[0].Data, `" "`, ""), `"`, ""))
+	}
+}
+
+func TestFromLibdnsRecordTXTChunks(t *testing.T) {
+	short := regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Name: "short", Value: "v=spf1 -all"}, "example.com")
+	assert.Equal(t, "v=spf1 -all", short.Data)
+
+	// A multi-byte character straddling the 255 byte boundary moves to
+	// the next chunk.
+	value := strings.Repeat("a", 254) + "ä" + strings.Repeat("b", 10)
+	long := regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Name: "long", Value: value}, "example.com")
+	assert.Equal(t, `"`+strings.Repeat("a", 254)+`" "ä`+strings.Repeat("b", 10)+`"`, long.Data)
+
+	quoted := `"` + strings.Repeat("a", 300) + `"`
+	assert.Equal(t, `"`+strings.Repeat("a", 255)+`" "`+strings.Repeat("a", 45)+`"`, regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Name: "q", Value: quoted}, "example.com").Data)
+}
+
+func TestLongTXTRoundTrip(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.SkipUnchanged = true
+	value := "v=DKIM1; k=rsa; p=" + strings.Repeat(`MIIBIjAN\"`, 40)
+	record := libdns.Record{Name: "sel._domainkey", Type: "TXT", Value: value, TTL: time.Hour}
+
+	written, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{record})
+	assert.Nil(t, err)
+	if assert.Len(t, written, 1) {
+		assert.Equal(t, value, written[0].Value)
+	}
+	assert.True(t, strings.HasPrefix(api.snapshot()[0].Data, `"v=DKIM1`))
+
+	records, err := p.GetRecords(context.Background(), test_zone)
+	assert.Nil(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, value, records[0].Value)
+	}
+	assert.Equal(t, record.Value, regfish.Normalize(record, test_zone).Value)
+
+	// Writing the value read back leaves the record alone.
+	_, err = p.SetRecords(context.Background(), test_zone, records)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, api.count("POST /dns/rr"))
+	assert.Len(t, api.snapshot(), 1)
+
+	// A value split differently by another tool still matches.
+	api.add(rfns.Record{Name: "split.example.com.", Type: "TXT", Data: `"v=spf1 " "-all"`, TTL: 3600})
+	_, err = p.DeleteRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "split", Type: "TXT", Value: "v=spf1 -all"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, api.snapshot(), 1)
+
+	// A single quoted string is unquoted like several.
+	assert.Equal(t, "v=spf1 -all", regfish.ToLibdnsRecord(rfns.Record{Type: "TXT", Data: `"v=spf1 -all"`}, test_zone).Value)
+}
+
+func TestNormalizeQuotedTXT(t *testing.T) {
+	for _, tc := range []struct {
+		value, want string
+	}{
+		{`"v=spf1 -all"`, "v=spf1 -all"},
+		{`"v=spf1 " "-all"`, "v=spf1 -all"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"say " "\"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{"v=spf1 -all", "v=spf1 -all"},
+	} {
+		record := libdns.Record{Name: "q", Type: "TXT", Value: tc.value, TTL: time.Hour}
+		normalized := regfish.Normalize(record, test_zone)
+		assert.Equal(t, tc.want, normalized.Value, tc.value)
+		assert.Equal(t, normalized, regfish.Normalize(normalized, test_zone), tc.value)
+	}
+}
+
+func TestRotateLongTXT(t *testing.T) {
+	oldValue, newValue := strings.Repeat("o", 300), strings.Repeat("n", 300)
+	api := newMockAPI(t)
+	p := api.provider()
+	_, err := p.AppendRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "_domainkey", Type: "TXT", Value: oldValue, TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+
+	result, err := p.RotateTXT(context.Background(), test_zone, "_domainkey", oldValue, newValue)
+	assert.Nil(t, err)
+	assert.Equal(t, newValue, result.Value)
+	if stored := api.snapshot(); assert.Len(t, stored, 1) {
+		assert.Equal(t, regfish.FromLibdnsRecord(libdns.Record{Type: "TXT", Value: newValue}, test_zone).Data, stored[0].Data)
+	}
+}
+
+func TestLongTXTQuoteAtChunkBoundary(t *testing.T) {
+	// The second chunk starts and ends with a quote and must still be
+	// quoted and escaped as a whole.
+	value := strings.Repeat("a", 255) + `"` + strings.Repeat("b", 253) + `"`
+	record := libdns.Record{Name: "q", Type: "TXT", Value: value, TTL: time.Hour}
+
+	rec := regfish.FromLibdnsRecord(record, test_zone)
+	assert.Equal(t, `"`+strings.Repeat("a", 255)+`" "\"`+strings.Repeat("b", 253)+`\""`, rec.Data)
+	assert.Equal(t, value, regfish.ToLibdnsRecord(rec, test_zone).Value)
+	assert.Equal(t, value, regfish.Normalize(record, test_zone).Value)
+}
+
+func TestChunkTXTQuoted(t *testing.T) {
+	for _, tc := range []struct {
+		name, value, data string
+	}{
+		{"quoted", `"v=spf1 -all"`, `"v=spf1 -all"`},
+		{"chunked", `"` + strings.Repeat("a", 255) + `" "b"`, `"` + strings.Repeat("a", 255) + `" "b"`},
+		{"unterminated", `"abc`, `"\"abc"`},
+		{"unterminated and long", `"abc` + strings.Repeat("x", 300), `"\"abc` + strings.Repeat("x", 251) + `" "` + strings.Repeat("x", 49) + `"`},
+		{"quoted and long", `"a" "` + strings.Repeat("b", 300) + `"`, `"a` + strings.Repeat("b", 254) + `" "` + strings.Repeat("b", 46) + `"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := regfish.FromLibdnsRecord(libdns.Record{Name: "q", Type: "TXT", Value: tc.value}, test_zone)
+			assert.Equal(t, tc.data, rec.Data)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package regfish
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+)
+
+// upsertOp is a write planned by planUpsert: an update of the record with
+// ID rrid, or a creation if rrid is 0.
+type upsertOp struct {
+	record libdns.Record
+	rrid   int
+}
+
+// UpsertRecords makes the zone hold the given records, fetching the zone
+// once and writing only what differs. Each record is matched to a live
+// record by its ID, if set, and by name and type otherwise, preferring a
+// live record that already holds the same data. A record whose ID is not
+// found in the zone, or that has the same ID as another record of the
+// batch, is an error rather than taking over another record, and nothing
+// is written then. Records that already exist as given are left alone,
+// records that match a live record with different data, TTL or priority
+// update it, and all others are created. Nothing is deleted. It returns
+// the records that were created or updated.
+//
+// Unlike SetRecords, which reads the zone again when it changes
+// concurrently and reads it back after writing, this makes a single read,
+// so it does not retry when the zone changes concurrently.
+func (p *Provider) UpsertRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	ctx, cancel := withTimeout(ctx, p.WriteTimeout)
+	defer cancel()
+
+	unlock, err := p.lock(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	zone, records, err = p.toAPI(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.checkRecords(records); err != nil {
+		return nil, err
+	}
+	existing, err := p.getRecordsForUpsert(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records for zone %s: %w", zone, err)
+	}
+
+	ops, err := planUpsert(existing, records, zone)
+	if err != nil {
+		return nil, err
+	}
+	var created []libdns.Record
+	for _, op := range ops {
+		if op.rrid == 0 {
+			created = append(created, op.record)
+		}
+	}
+	if err := p.checkRecordsPerName(existing, created, zone); err != nil {
+		return nil, err
+	}
+	if len(ops) > 0 {
+		defer p.invalidateCache(zone)
+	}
+
+	var changed []libdns.Record
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return p.fromAPI(changed), fmt.Errorf("failed to update record %s: %w", op.record.Name, err)
+		}
+		rec := convertFromLibdnsRecord(op.record, zone)
+		var written rfns.Record
+		if op.rrid != 0 {
+			written, err = p.updateRecord(ctx, op.rrid, rec)
+		} else {
+			written, err = p.createRecord(ctx, rec)
+		}
+		if err != nil {
+			return p.fromAPI(changed), fmt.Errorf("failed to update record %s: %w", op.record.Name, err)
+		}
+		changed = append(changed, convertToLibdnsRecord(written, zone))
+	}
+
+	return p.fromAPI(changed), nil
+}
+
+// planUpsert returns the writes needed to make the zone with the existing
+// records hold records, as described for UpsertRecords. Records with an ID
+// are only ever matched to the live record with that ID, which no other
+// record of the batch may name.
+func planUpsert(existing []rfns.Record, records []libdns.Record, zone string) ([]upsertOp, error) {
+	index := newRecordIndex(existing, zone)
+	used := make(map[int]bool)
+	matched := make([]int, len(records))
+
+	// First pass: records given by ID, which take their live record before
+	// any record without an ID can.
+	for i, record := range records {
+		if record.ID == "" {
+			continue
+		}
+		rec, ok := index.byRecordID(record)
+		if !ok {
+			return nil, fmt.Errorf("record %s of type %s with ID %s not found", record.Name, record.Type, record.ID)
+		}
+		if used[rec.ID] {
+			return nil, fmt.Errorf("record %s of type %s has ID %s, as does another record of the batch", record.Name, record.Type, record.ID)
+		}
+		used[rec.ID] = true
+		matched[i] = rec.ID
+		if sameRecord(rec, record, zone) {
+			matched[i] = -1
+		}
+	}
+
+	// Second pass: records without an ID that exist unchanged.
+	for i, record := range records {
+		if record.ID != "" {
+			continue
+		}
+		for _, rec := range index.lookup(record) {
+			if used[rec.ID] || !sameRecord(rec, record, zone) {
+				continue
+			}
+			used[rec.ID] = true
+			matched[i] = -1
+			break
+		}
+	}
+
+	// Third pass: remaining records update a live record of the same name
+	// and type, or are created.
+	var ops []upsertOp
+	for i, record := range records {
+		switch {
+		case matched[i] < 0:
+			continue
+		case matched[i] > 0:
+			ops = append(ops, upsertOp{record: record, rrid: matched[i]})
+			continue
+		}
+
+		op := upsertOp{record: record}
+		for _, rec := range index.lookup(record) {
+			if !used[rec.ID] {
+				used[rec.ID] = true
+				op.rrid = rec.ID
+				break
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// sameRecord reports whether rec holds exactly what would be written for
+// record.
+func sameRecord(rec rfns.Record, record libdns.Record, zone string) bool {
+	want := convertFromLibdnsRecord(record, zone)
+	return strings.EqualFold(strings.TrimSuffix(rec.Name, "."), strings.TrimSuffix(want.Name, ".")) &&
+		strings.EqualFold(rec.Type, want.Type) && rec.Data == want.Data && rec.TTL == want.TTL &&
+		getPriority(rec.Priority) == getPriority(want.Priority)
+}
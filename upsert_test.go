@@ -0,0 +1,160 @@
+package regfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsertRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+		rfns.Record{Name: "mail.example.com.", Type: "A", Data: "10.0.1.1", TTL: 300},
+		rfns.Record{Name: "example.com.", Type: "MX", Data: "mail.example.com.", TTL: 3600, Priority: intPtr(10)},
+	)
+
+	changed, err := api.provider().UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		// no-op: both A records at www exist as given
+		{Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		// update: new address for mail
+		{Name: "mail", Type: "A", Value: "10.0.1.2", TTL: 5 * time.Minute},
+		// update: priority only
+		{Name: "", Type: "MX", Value: "mail.example.com.", TTL: time.Hour, Priority: 20},
+		// create
+		{Name: "ftp", Type: "CNAME", Value: "www.example.com.", TTL: time.Hour},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1003", Name: "mail", Type: "A", Value: "10.0.1.2", TTL: 5 * time.Minute},
+		{ID: "1004", Name: "", Type: "MX", Value: "mail.example.com.", TTL: time.Hour, Priority: 20},
+		{ID: "1005", Name: "ftp", Type: "CNAME", Value: "www.example.com.", TTL: time.Hour},
+	}, changed)
+
+	assert.Equal(t, 1, api.count("GET /dns/example.com/rr"))
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1002"))
+	assert.Equal(t, 1, api.count("POST /dns/rr"))
+	assert.Len(t, api.snapshot(), 5)
+}
+
+func TestUpsertRecordsNoop(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	changed, err := api.provider().UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+}
+
+func TestUpsertRecordsNoopCase(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "WWW.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+	p := api.provider()
+
+	changed, err := p.UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "a", Value: "10.0.0.1", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+
+	p.SkipUnchanged = true
+	_, err = p.SetRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "a", Value: "10.0.0.1", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+}
+
+func TestUpsertRecordsStaleID(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	// The record with ID 999 is gone; the other record at www must not
+	// take its place.
+	changed, err := api.provider().UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "api", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+		{ID: "999", Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+	})
+	assert.ErrorContains(t, err, "ID 999 not found")
+	assert.Empty(t, changed)
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+	if assert.Len(t, api.snapshot(), 1) {
+		assert.Equal(t, "10.0.0.1", api.snapshot()[0].Data)
+	}
+}
+
+func TestUpsertRecordsIDFirst(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.2", TTL: 300},
+	)
+
+	// The record without an ID comes first but must leave record 1001 to
+	// the record that names it.
+	changed, err := api.provider().UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		{Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []libdns.Record{
+		{ID: "1002", Name: "www", Type: "A", Value: "10.0.0.1", TTL: 5 * time.Minute},
+		{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+	}, changed)
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+}
+
+func TestUpsertRecordsDuplicateID(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	changed, err := api.provider().UpsertRecords(context.Background(), test_zone, []libdns.Record{
+		{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.2", TTL: 5 * time.Minute},
+		{ID: "1001", Name: "www", Type: "A", Value: "10.0.0.3", TTL: 5 * time.Minute},
+	})
+	assert.ErrorContains(t, err, "has ID 1001, as does another record of the batch")
+	assert.Empty(t, changed)
+	assert.Equal(t, 0, api.count("PATCH /dns/rr/1001"))
+}
+
+func BenchmarkUpsertRecords(b *testing.B) {
+	var existing []rfns.Record
+	var records []libdns.Record
+	for i := 0; i < 100; i++ {
+		existing = append(existing, rfns.Record{Name: fmt.Sprintf("host%d.example.com.", i), Type: "A", Data: "10.0.0.1", TTL: 300})
+		value := "10.0.0.1"
+		if i%10 == 0 {
+			value = "10.0.0.2"
+		}
+		records = append(records, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: value, TTL: 5 * time.Minute})
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		api := newMockAPI(b, existing...)
+		p := api.provider()
+		b.StartTimer()
+
+		if _, err := p.UpsertRecords(context.Background(), test_zone, records); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		api.server.Close()
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,84 @@
+package regfish
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// URI is the parsed form of a URI record, which maps a service, such as
+// "_http._tcp", to a URI.
+type URI struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// ParseURI parses a URI record as the Provider returns it, with the
+// priority in Priority and the weight and quoted target in Value, such as
+// `1 "https://www.example.com/"`. A priority in front of the value, as in
+// zone file form, is accepted if Priority is not set.
+func ParseURI(record libdns.Record) (URI, error) {
+	if !strings.EqualFold(record.Type, "URI") {
+		return URI{}, fmt.Errorf("record %s of type %s is no URI record", record.Name, record.Type)
+	}
+	priority, data := splitPriority(record)
+	if priority < 0 || priority > 65535 {
+		return URI{}, fmt.Errorf("invalid URI priority %d", priority)
+	}
+	weight, target, err := parseURIData(data)
+	if err != nil {
+		return URI{}, err
+	}
+	return URI{Priority: uint16(priority), Weight: weight, Target: target}, nil
+}
+
+// parseURIData parses the weight and target of a URI record. The target
+// may be quoted.
+func parseURIData(data string) (uint16, string, error) {
+	parts := strings.Fields(data)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("malformed URI value %q; expected: '<weight> \"<target>\"'", data)
+	}
+	weight, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid URI weight %s: %v", parts[0], err)
+	}
+	target := parts[1]
+	if strings.HasPrefix(target, `"`) {
+		if len(target) < 2 || !strings.HasSuffix(target, `"`) {
+			return 0, "", fmt.Errorf("malformed URI value %q: unterminated quote", data)
+		}
+		target = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(target[1 : len(target)-1])
+	}
+	return uint16(weight), target, nil
+}
+
+// Record returns u as a URI record with the given name and TTL, in the
+// form the Provider reads and writes URI records: the priority in
+// Priority and the weight and quoted target in Value.
+func (u URI) Record(name string, ttl time.Duration) libdns.Record {
+	return libdns.Record{
+		Type:     "URI",
+		Name:     name,
+		Value:    fmt.Sprintf("%d %s", u.Weight, quoteTXT(u.Target)),
+		TTL:      ttl,
+		Priority: int(u.Priority),
+	}
+}
+
+// validate checks that the target of u is an absolute URI.
+func (u URI) validate() error {
+	target, err := url.Parse(u.Target)
+	if err != nil {
+		return fmt.Errorf("invalid URI target %q: %v", u.Target, err)
+	}
+	if !target.IsAbs() {
+		return fmt.Errorf("URI target %q has no scheme", u.Target)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package regfish_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseURI(t *testing.T) {
+	for _, record := range []libdns.Record{
+		{Type: "URI", Name: "_http._tcp", Value: `1 "https://www.example.com/"`, Priority: 10},
+		{Type: "URI", Name: "_http._tcp", Value: `10 1 "https://www.example.com/"`},
+		{Type: "uri", Name: "_http._tcp", Value: `1 https://www.example.com/`, Priority: 10},
+	} {
+		u, err := regfish.ParseURI(record)
+		assert.Nil(t, err, record.Value)
+		assert.Equal(t, regfish.URI{Priority: 10, Weight: 1, Target: "https://www.example.com/"}, u, record.Value)
+	}
+
+	u := regfish.URI{Priority: 10, Weight: 1, Target: "ftp://ftp.example.com/public"}
+	record := u.Record("_ftp._tcp", time.Hour)
+	assert.Equal(t, libdns.Record{Type: "URI", Name: "_ftp._tcp", Value: `1 "ftp://ftp.example.com/public"`, TTL: time.Hour, Priority: 10}, record)
+
+	rec := regfish.FromLibdnsRecord(libdns.Record{Type: "URI", Name: "_ftp._tcp", Value: `10 1 ftp://ftp.example.com/public`}, "example.com.")
+	assert.Equal(t, `1 "ftp://ftp.example.com/public"`, rec.Data)
+	if assert.NotNil(t, rec.Priority) {
+		assert.Equal(t, 10, *rec.Priority)
+	}
+
+	for _, value := range []string{`1`, `x "https://www.example.com/"`, `1 "https://www.example.com/`} {
+		_, err := regfish.ParseURI(libdns.Record{Type: "URI", Value: value, Priority: 10})
+		assert.NotNil(t, err, value)
+	}
+	_, err := regfish.ParseURI(libdns.Record{Type: "TXT", Value: `1 "https://www.example.com/"`})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, regfish.ValidateRecord(record))
+	assert.ErrorContains(t, regfish.ValidateRecord(libdns.Record{Type: "URI", Name: "_http._tcp", Value: `1 "www.example.com"`, Priority: 10}), "no scheme")
+}
@@ -0,0 +1,144 @@
+package regfish
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// ValidateRecord checks record for mistakes that regfish would reject or
+// that would result in a broken record, such as a malformed IP address in
+// an A record or a host name containing spaces. It does not contact the
+// regfish API.
+func ValidateRecord(record libdns.Record) error {
+	if err := validateRecord(record); err != nil {
+		return fmt.Errorf("invalid record %s of type %s: %w", record.Name, record.Type, err)
+	}
+	return nil
+}
+
+func validateRecord(record libdns.Record) error {
+	if record.Type == "" {
+		return fmt.Errorf("type is empty")
+	}
+	if err := validateName(record.Name); err != nil {
+		return err
+	}
+	if record.TTL < 0 {
+		return fmt.Errorf("TTL %s is negative", record.TTL)
+	}
+	if record.Priority < 0 || record.Priority > 65535 {
+		return fmt.Errorf("priority %d is out of range", record.Priority)
+	}
+	if strings.TrimSpace(record.Value) == "" {
+		return fmt.Errorf("value is empty")
+	}
+
+	// Data in the generic form of RFC 3597 is valid for any type, and the
+	// only form for types given by number.
+	if isGenericData(record.Value) {
+		_, err := ParseGenericData(record.Value)
+		return err
+	}
+	if _, ok := GenericType(record.Type); ok {
+		return fmt.Errorf("value of type %s is not in the generic form '\\# <length> <hex data>'", record.Type)
+	}
+
+	switch strings.ToUpper(record.Type) {
+	case "A":
+		if ip := net.ParseIP(record.Value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q is not an IPv4 address", record.Value)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(record.Value); ip == nil || !strings.Contains(record.Value, ":") {
+			return fmt.Errorf("%q is not an IPv6 address", record.Value)
+		}
+	case "HTTPS", "SVCB":
+		b, err := ParseServiceBinding(record)
+		if err != nil {
+			return err
+		}
+		return b.validate()
+	case "TLSA", "SMIMEA":
+		t, err := ParseTLSA(record.Value)
+		if err != nil {
+			return err
+		}
+		return t.validate()
+	case "CERT":
+		if _, err := ParseCERT(record.Value); err != nil {
+			return err
+		}
+	case "OPENPGPKEY":
+		if _, err := ParseOPENPGPKEY(record.Value); err != nil {
+			return err
+		}
+	case "DS", "CDS":
+		if strings.EqualFold(record.Type, "DS") && normalizeName(record.Name) == "" {
+			return fmt.Errorf("DS records belong to the parent zone, not the zone apex")
+		}
+		d, err := ParseDS(record.Value)
+		if err != nil {
+			return err
+		}
+		return d.validate()
+	case "DNSKEY", "CDNSKEY":
+		k, err := ParseDNSKEY(record.Value)
+		if err != nil {
+			return err
+		}
+		return k.validate()
+	case "URI":
+		u, err := ParseURI(record)
+		if err != nil {
+			return err
+		}
+		return u.validate()
+	case "LOC":
+		if _, err := ParseLOC(record.Value); err != nil {
+			return err
+		}
+	case "HINFO":
+		if _, err := ParseHINFO(record.Value); err != nil {
+			return err
+		}
+	case "RP":
+		if _, err := ParseRP(record.Value); err != nil {
+			return err
+		}
+	case "CNAME", "NS", "PTR", "DNAME", "ALIAS", "ANAME":
+		if strings.EqualFold(record.Type, "CNAME") && normalizeName(record.Name) == "" {
+			return fmt.Errorf("a CNAME record cannot be at the zone apex, where the SOA and NS records are; use an ALIAS record instead")
+		}
+		if strings.ContainsAny(strings.TrimSpace(record.Value), " \t") {
+			return fmt.Errorf("%q is not a host name", record.Value)
+		}
+	}
+
+	return nil
+}
+
+// validateName checks that name is a syntactically valid domain name.
+func validateName(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || name == "@" {
+		return nil
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("name is longer than 253 characters")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("name %q contains an empty label", name)
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+		if strings.ContainsAny(label, " \t") {
+			return fmt.Errorf("label %q contains whitespace", label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package regfish_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record libdns.Record
+		err    string
+	}{
+		{"valid A", libdns.Record{Type: "A", Name: "www", Value: "192.0.2.1"}, ""},
+		{"valid AAAA", libdns.Record{Type: "AAAA", Name: "www", Value: "2001:db8::1"}, ""},
+		{"valid apex MX", libdns.Record{Type: "MX", Name: "@", Value: "mx.example.net.", Priority: 10}, ""},
+		{"valid TXT", libdns.Record{Type: "TXT", Name: "_acme-challenge", Value: "token with spaces"}, ""},
+		{"missing type", libdns.Record{Name: "www", Value: "192.0.2.1"}, "type is empty"},
+		{"missing value", libdns.Record{Type: "TXT", Name: "www"}, "value is empty"},
+		{"negative TTL", libdns.Record{Type: "A", Name: "www", Value: "192.0.2.1", TTL: -time.Second}, "negative"},
+		{"priority out of range", libdns.Record{Type: "MX", Name: "", Value: "mx.", Priority: 70000}, "out of range"},
+		{"IPv6 in A", libdns.Record{Type: "A", Name: "www", Value: "2001:db8::1"}, "not an IPv4 address"},
+		{"IPv4 in AAAA", libdns.Record{Type: "AAAA", Name: "www", Value: "192.0.2.1"}, "not an IPv6 address"},
+		{"bad CNAME target", libdns.Record{Type: "CNAME", Name: "www", Value: "example .com."}, "not a host name"},
+		{"empty label", libdns.Record{Type: "A", Name: "a..b", Value: "192.0.2.1"}, "empty label"},
+		{"valid HTTPS", libdns.Record{Type: "HTTPS", Name: "www", Value: ". alpn=h2,h3 port=8443 ipv6hint=2001:db8::1 mandatory=alpn", Priority: 1}, ""},
+		{"valid HTTPS alias", libdns.Record{Type: "HTTPS", Name: "", Value: "cdn.example.net."}, ""},
+		{"HTTPS alias with params", libdns.Record{Type: "HTTPS", Name: "", Value: "cdn.example.net. alpn=h2"}, "alias mode"},
+		{"bad SVCB port", libdns.Record{Type: "SVCB", Name: "_dns", Value: ". port=70000", Priority: 1}, "invalid value"},
+		{"bad SVCB hint", libdns.Record{Type: "SVCB", Name: "_dns", Value: ". ipv4hint=2001:db8::1", Priority: 1}, "invalid value"},
+		{"SVCB missing mandatory", libdns.Record{Type: "SVCB", Name: "_dns", Value: ". mandatory=port", Priority: 1}, "invalid value"},
+		{"valid apex ALIAS", libdns.Record{Type: "ALIAS", Name: "@", Value: "cdn.example.net."}, ""},
+		{"bad ANAME target", libdns.Record{Type: "ANAME", Name: "", Value: "cdn example.net."}, "not a host name"},
+		{"apex CNAME", libdns.Record{Type: "CNAME", Name: "@", Value: "cdn.example.net."}, "use an ALIAS record"},
+		{"long label", libdns.Record{Type: "A", Name: strings.Repeat("a", 64), Value: "192.0.2.1"}, "longer than 63"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := regfish.ValidateRecord(tt.record)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPreValidate(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "one", Type: "A", Value: "192.0.2.1"},
+		{Name: "two", Type: "A", Value: "not-an-ip"},
+		{Name: "three", Type: "A", Value: "192.0.2.3"},
+	}
+
+	api := newMockAPI(t)
+	p := api.provider()
+	p.PreValidate = true
+
+	_, err := p.AppendRecords(context.Background(), test_zone, records)
+	assert.ErrorContains(t, err, "invalid record two of type A")
+	_, err = p.SetRecords(context.Background(), test_zone, records)
+	assert.ErrorContains(t, err, "invalid record two of type A")
+
+	assert.Empty(t, api.snapshot())
+	assert.Equal(t, 0, api.count("POST /dns/rr"))
+	assert.Equal(t, 0, api.count("GET /dns/example.com/rr"))
+}
@@ -0,0 +1,78 @@
+package regfish
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// ZoneRecord is a record tagged with the zone it belongs to.
+type ZoneRecord struct {
+	Zone   string
+	Record libdns.Record
+}
+
+// ZoneErrors holds the errors of a multi-zone operation, keyed by zone.
+type ZoneErrors map[string]error
+
+// Error implements the error interface.
+func (e ZoneErrors) Error() string {
+	zones := make([]string, 0, len(e))
+	for zone := range e {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	msgs := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		msgs = append(msgs, zone+": "+e[zone].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SetZoneRecords sets records across several zones, for example a zone and
+// a subdomain delegated to its own zone. Records are grouped by zone and
+// each group is written with SetRecords, so every zone is locked and
+// updated on its own. A failing zone does not stop the others; the records
+// set are returned grouped by zone together with a ZoneErrors describing
+// the zones that failed, if any. The records SetRecords set in a failing
+// zone before it failed are returned as well.
+//
+// Zones are compared regardless of case and trailing dot, so the records
+// of one zone given in several spellings, such as "example.com" and
+// "Example.com.", are set together. Results and errors are keyed by the
+// spelling the zone is first given in.
+func (p *Provider) SetZoneRecords(ctx context.Context, records []ZoneRecord) (map[string][]libdns.Record, error) {
+	var zones []string
+	spellings := make(map[string]string)
+	byZone := make(map[string][]libdns.Record)
+	for _, rec := range records {
+		key := zoneKey(rec.Zone)
+		zone, ok := spellings[key]
+		if !ok {
+			zone = rec.Zone
+			spellings[key] = zone
+			zones = append(zones, zone)
+		}
+		byZone[zone] = append(byZone[zone], rec.Record)
+	}
+
+	results := make(map[string][]libdns.Record)
+	errs := make(ZoneErrors)
+	for _, zone := range zones {
+		set, err := p.SetRecords(ctx, zone, byZone[zone])
+		if len(set) > 0 {
+			results[zone] = set
+		}
+		if err != nil {
+			errs[zone] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
@@ -0,0 +1,134 @@
+package regfish_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/regfish"
+	rfns "github.com/regfish/regfish-dnsapi-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneRecords(t *testing.T) {
+	api := newMockAPI(t,
+		rfns.Record{Name: "www.example.com.", Type: "A", Data: "10.0.0.1", TTL: 300},
+	)
+
+	result, err := api.provider().SetZoneRecords(context.Background(), []regfish.ZoneRecord{
+		{Zone: "example.com.", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.0.2", TTL: time.Minute}},
+		{Zone: "sub.example.com.", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.1.1", TTL: time.Minute}},
+		{Zone: "example.com.", Record: libdns.Record{Name: "mail", Type: "A", Value: "10.0.0.3", TTL: time.Minute}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result["example.com."], 2)
+	if assert.Len(t, result["sub.example.com."], 1) {
+		assert.Equal(t, "www", result["sub.example.com."][0].Name)
+	}
+
+	stored := api.snapshot()
+	assert.Len(t, stored, 3)
+	assert.Equal(t, "10.0.0.2", stored[0].Data)
+	assert.Equal(t, "mail.example.com.", stored[1].Name)
+	assert.Equal(t, "www.sub.example.com.", stored[2].Name)
+}
+
+func TestSetZoneRecordsPartialFailure(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+	p.MaxRecordsPerName = 1
+
+	result, err := p.SetZoneRecords(context.Background(), []regfish.ZoneRecord{
+		{Zone: "example.com.", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"}},
+		{Zone: "example.org.", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"}},
+		{Zone: "example.org.", Record: libdns.Record{Name: "www", Type: "AAAA", Value: "2001:db8::1"}},
+	})
+
+	var zoneErrs regfish.ZoneErrors
+	if assert.True(t, errors.As(err, &zoneErrs)) {
+		assert.Len(t, zoneErrs, 1)
+		assert.Error(t, zoneErrs["example.org."])
+	}
+	assert.Len(t, result["example.com."], 1)
+	assert.NotContains(t, result, "example.org.")
+}
+
+func TestSetZoneRecordsSpellings(t *testing.T) {
+	api := newMockAPI(t)
+
+	result, err := api.provider().SetZoneRecords(context.Background(), []regfish.ZoneRecord{
+		{Zone: "example.com", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"}},
+		{Zone: "Example.com.", Record: libdns.Record{Name: "mail", Type: "A", Value: "10.0.0.2"}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.Len(t, result["example.com"], 2)
+	assert.Len(t, api.snapshot(), 2)
+	// Both spellings are written in a single SetRecords call.
+	assert.Equal(t, 2, api.count("GET /dns/example.com/rr"))
+}
+
+func TestSetZoneRecordsPartialWrite(t *testing.T) {
+	api := newMockAPI(t)
+	posts := 0
+	api.fail = func(r *http.Request) (int, string) {
+		if r.Method != http.MethodPost {
+			return 0, ""
+		}
+		if posts++; posts == 2 {
+			return http.StatusBadRequest, `{"message": "invalid record"}`
+		}
+		return 0, ""
+	}
+
+	result, err := api.provider().SetZoneRecords(context.Background(), []regfish.ZoneRecord{
+		{Zone: "example.com.", Record: libdns.Record{Name: "www", Type: "A", Value: "10.0.0.1"}},
+		{Zone: "example.com.", Record: libdns.Record{Name: "mail", Type: "A", Value: "10.0.0.2"}},
+	})
+
+	var zoneErrs regfish.ZoneErrors
+	if assert.True(t, errors.As(err, &zoneErrs)) {
+		assert.Error(t, zoneErrs["example.com."])
+	}
+	if assert.Len(t, result["example.com."], 1) {
+		assert.Equal(t, "www", result["example.com."][0].Name)
+	}
+}
+
+func TestZoneLocks(t *testing.T) {
+	api := newMockAPI(t)
+	p := api.provider()
+
+	// A write to one zone that is held up does not hold up writes to
+	// another zone, but does hold up writes to the same zone, however it
+	// is spelled.
+	started, release := make(chan struct{}), make(chan struct{})
+	var held int32
+	api.before = func(r *http.Request) {
+		if r.Method == http.MethodPost && atomic.CompareAndSwapInt32(&held, 0, 1) {
+			close(started)
+			<-release
+		}
+	}
+	done := make(chan error)
+	go func() {
+		_, err := p.AppendRecords(context.Background(), "example.com.", []libdns.Record{{Name: "a", Type: "A", Value: "10.0.0.1"}})
+		done <- err
+	}()
+	<-started
+
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{{Name: "a", Type: "A", Value: "10.0.0.1"}})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.AppendRecords(ctx, "Example.COM", []libdns.Record{{Name: "b", Type: "A", Value: "10.0.0.2"}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	assert.Nil(t, <-done)
+}